@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikaelmello/pingo/core"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// checkOK is the plugin exit code when every threshold is respected
+	checkOK = 0
+
+	// checkWarning is the plugin exit code when a warning threshold is reached
+	checkWarning = 1
+
+	// checkCritical is the plugin exit code when a critical threshold is reached
+	checkCritical = 2
+
+	// checkUnknown is the plugin exit code when the check could not be executed
+	checkUnknown = 3
+)
+
+// checkStatuses are the status names of the plugin output, indexed by exit code
+var checkStatuses = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// checkThreshold is a pair of round trip average and packet loss limits
+type checkThreshold struct {
+	// rta is the round trip average in milliseconds
+	rta float64
+
+	// pl is the packet loss in percent
+	pl float64
+}
+
+// checkOptions contains the settings of the check command
+type checkOptions struct {
+	warning      string
+	critical     string
+	packets      int
+	timeout      int
+	isPrivileged bool
+}
+
+var checkOpts = checkOptions{
+	packets: 5,
+	timeout: 10,
+}
+
+var checkCmd = &cobra.Command{
+	Use:   "check [hostname or ip address]",
+	Short: "Nagios/Icinga compatible check plugin",
+	Long: "check sends a fixed amount of echo requests and reports the round trip average and packet loss using " +
+		"the monitoring plugin output format, exiting with 0 (OK), 1 (WARNING), 2 (CRITICAL) or 3 (UNKNOWN).",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var out string
+		code, out = runCheck(args[0], checkOpts)
+		fmt.Println(out)
+	},
+}
+
+func init() {
+	checkCmd.Flags().StringVarP(&checkOpts.warning, "warning", "w", checkOpts.warning,
+		"Warning threshold pair <rta>,<pl>%, where rta is the round trip average in milliseconds and pl the packet "+
+			"loss in percent, e.g. 100,20%.")
+	checkCmd.Flags().StringVarP(&checkOpts.critical, "critical", "c", checkOpts.critical,
+		"Critical threshold pair <rta>,<pl>%, where rta is the round trip average in milliseconds and pl the packet "+
+			"loss in percent, e.g. 500,60%.")
+	checkCmd.Flags().IntVarP(&checkOpts.packets, "packets", "p", checkOpts.packets,
+		"Number of ECHO_REQUEST packets to send.")
+	checkCmd.Flags().IntVarP(&checkOpts.timeout, "timeout", "t", checkOpts.timeout,
+		"Seconds before the check stops regardless of how many packets have been sent or received.")
+	checkCmd.Flags().BoolVar(&checkOpts.isPrivileged, "privileged", checkOpts.isPrivileged,
+		"Whether to use privileged mode, see the same option of the root command.")
+	_ = checkCmd.MarkFlagRequired("warning")
+	_ = checkCmd.MarkFlagRequired("critical")
+
+	rootCmd.AddCommand(checkCmd)
+}
+
+// runCheck pings addr according to opts, returning the plugin exit code and output.
+func runCheck(addr string, opts checkOptions) (int, string) {
+	warning, err := parseCheckThreshold(opts.warning)
+	if err != nil {
+		return checkUnknownResult(fmt.Errorf("invalid warning threshold: %w", err))
+	}
+
+	critical, err := parseCheckThreshold(opts.critical)
+	if err != nil {
+		return checkUnknownResult(fmt.Errorf("invalid critical threshold: %w", err))
+	}
+
+	if warning.rta > critical.rta || warning.pl > critical.pl {
+		return checkUnknownResult(fmt.Errorf("warning thresholds must not be larger than critical thresholds"))
+	}
+
+	settings := core.DefaultSettings()
+	settings.MaxCount = opts.packets
+	settings.IsMaxCountDefault = false
+	settings.IsPrivileged = opts.isPrivileged
+
+	s, err := core.NewSession(addr, settings)
+	if err != nil {
+		return checkUnknownResult(err)
+	}
+
+	// a deadline would keep sending until count replies, the timeout must only bound the fixed amount of packets
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(opts.timeout)*time.Second)
+	defer cancel()
+
+	if err := s.RunContext(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return checkUnknownResult(err)
+	}
+
+	return checkResult(s.Stats, warning, critical)
+}
+
+// parseCheckThreshold parses a threshold pair in the format <rta>,<pl>%.
+func parseCheckThreshold(val string) (checkThreshold, error) {
+	parts := strings.Split(val, ",")
+	if len(parts) != 2 || !strings.HasSuffix(parts[1], "%") {
+		return checkThreshold{}, fmt.Errorf("%q is not in the format <rta>,<pl>%%", val)
+	}
+
+	rta, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || rta < 0 {
+		return checkThreshold{}, fmt.Errorf("%q is not a valid round trip average", parts[0])
+	}
+
+	pl, err := strconv.ParseFloat(strings.TrimSuffix(parts[1], "%"), 64)
+	if err != nil || pl < 0 || pl > 100 {
+		return checkThreshold{}, fmt.Errorf("%q is not a valid packet loss", parts[1])
+	}
+
+	return checkThreshold{rta: rta, pl: pl}, nil
+}
+
+// checkResult compares the stats to the thresholds, returning the plugin exit code and output.
+func checkResult(stats core.Statistics, warning checkThreshold, critical checkThreshold) (int, string) {
+	pl := stats.GetPktLoss() * 100
+	replied := stats.GetTotalRecv() > 0
+	rta := toMilliseconds(time.Duration(stats.GetRTTAvg()))
+
+	code := checkOK
+	switch {
+	case !replied || pl >= critical.pl || rta >= critical.rta:
+		code = checkCritical
+	case pl >= warning.pl || rta >= warning.rta:
+		code = checkWarning
+	}
+
+	// as check_ping does, the rtts are left out of the output and empty in the perfdata when there are none
+	rtaText := ""
+	rtaPerf := ""
+	rtminPerf := ""
+	rtmaxPerf := ""
+	if replied {
+		rtaText = fmt.Sprintf(", RTA = %.2f ms", rta)
+		rtaPerf = fmt.Sprintf("%.3fms", rta)
+		rtminPerf = fmt.Sprintf("%.3fms", toMilliseconds(time.Duration(stats.GetRTTMin())))
+		rtmaxPerf = fmt.Sprintf("%.3fms", toMilliseconds(time.Duration(stats.GetRTTMax())))
+	}
+
+	out := fmt.Sprintf("PING %s - Packet loss = %.0f%%%s|rta=%s;%.3f;%.3f;0 pl=%.0f%%;%.0f;%.0f;0;100 "+
+		"rtmin=%s;;;0 rtmax=%s;;;0", checkStatuses[code], pl, rtaText, rtaPerf, warning.rta, critical.rta,
+		pl, warning.pl, critical.pl, rtminPerf, rtmaxPerf)
+
+	return code, out
+}
+
+// checkUnknownResult returns the plugin exit code and output of a check that could not be executed.
+func checkUnknownResult(err error) (int, string) {
+	return checkUnknown, fmt.Sprintf("PING %s - %s", checkStatuses[checkUnknown], err)
+}
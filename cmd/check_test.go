@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikaelmello/pingo/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseCheckThreshold tests if valid threshold pairs are parsed and invalid ones refused
+func TestParseCheckThreshold(t *testing.T) {
+	th, err := parseCheckThreshold("100,20%")
+	assert.NoError(t, err)
+	assert.Equal(t, checkThreshold{rta: 100, pl: 20}, th)
+
+	th, err = parseCheckThreshold("0.5,0%")
+	assert.NoError(t, err)
+	assert.Equal(t, checkThreshold{rta: 0.5, pl: 0}, th)
+
+	for _, val := range []string{"", "100", "100,20", "abc,20%", "100,abc%", "-1,20%", "100,101%", "100,20%,3"} {
+		_, err := parseCheckThreshold(val)
+		assert.Error(t, err, val)
+	}
+}
+
+// TestCheckResultOK tests the output when no threshold is reached
+func TestCheckResultOK(t *testing.T) {
+	stats := core.NewStatistics()
+	for i := 0; i < 5; i++ {
+		stats.EchoRequested()
+	}
+	for _, rtt := range []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond} {
+		stats.EchoReplied(uint64(rtt))
+	}
+	stats.EchoReplied(uint64(2 * time.Millisecond))
+	stats.EchoReplied(uint64(2 * time.Millisecond))
+
+	code, out := checkResult(stats, checkThreshold{rta: 100, pl: 20}, checkThreshold{rta: 500, pl: 60})
+	assert.Equal(t, checkOK, code)
+	assert.Equal(t, "PING OK - Packet loss = 0%, RTA = 2.00 ms|rta=2.000ms;100.000;500.000;0 pl=0%;20;60;0;100 "+
+		"rtmin=1.000ms;;;0 rtmax=3.000ms;;;0", out)
+}
+
+// TestCheckResultWarning tests if reaching a warning threshold is reported
+func TestCheckResultWarning(t *testing.T) {
+	stats := core.NewStatistics()
+	for i := 0; i < 4; i++ {
+		stats.EchoRequested()
+	}
+	for i := 0; i < 3; i++ {
+		stats.EchoReplied(uint64(10 * time.Millisecond))
+	}
+
+	code, _ := checkResult(stats, checkThreshold{rta: 100, pl: 20}, checkThreshold{rta: 500, pl: 60})
+	assert.Equal(t, checkWarning, code)
+
+	code, _ = checkResult(stats, checkThreshold{rta: 10, pl: 50}, checkThreshold{rta: 500, pl: 60})
+	assert.Equal(t, checkWarning, code)
+}
+
+// TestCheckResultCritical tests if reaching a critical threshold is reported
+func TestCheckResultCritical(t *testing.T) {
+	stats := core.NewStatistics()
+	stats.EchoRequested()
+	stats.EchoRequested()
+	stats.EchoReplied(uint64(600 * time.Millisecond))
+
+	code, _ := checkResult(stats, checkThreshold{rta: 100, pl: 20}, checkThreshold{rta: 500, pl: 60})
+	assert.Equal(t, checkCritical, code)
+}
+
+// TestCheckResultAllLost tests if losing everything is critical, without an RTA in the output nor in the perfdata
+func TestCheckResultAllLost(t *testing.T) {
+	stats := core.NewStatistics()
+	for i := 0; i < 3; i++ {
+		stats.EchoRequested()
+	}
+
+	code, out := checkResult(stats, checkThreshold{rta: 100, pl: 20}, checkThreshold{rta: 500, pl: 100})
+	assert.Equal(t, checkCritical, code)
+	assert.Equal(t, "PING CRITICAL - Packet loss = 100%|rta=;100.000;500.000;0 pl=100%;20;100;0;100 "+
+		"rtmin=;;;0 rtmax=;;;0", out)
+	assert.NotContains(t, strings.ToLower(out), "nan")
+}
+
+// TestCheckUnknownResult tests the output of a check that could not be executed
+func TestCheckUnknownResult(t *testing.T) {
+	code, out := checkUnknownResult(fmt.Errorf("boom"))
+	assert.Equal(t, checkUnknown, code)
+	assert.Equal(t, "PING UNKNOWN - boom", out)
+
+	code, _ = runCheck("localhost", checkOptions{warning: "500,60%", critical: "100,20%", packets: 1, timeout: 1})
+	assert.Equal(t, checkUnknown, code)
+}
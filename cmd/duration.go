@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// secondsValue is a flag value holding a duration, which accepts either an amount of seconds, as ping does, or a
+// duration with a unit, e.g. 250ms.
+type secondsValue time.Duration
+
+// newSecondsValue sets p to val and returns a flag value that changes p.
+func newSecondsValue(val time.Duration, p *time.Duration) *secondsValue {
+	*p = val
+	return (*secondsValue)(p)
+}
+
+// Set parses an amount of seconds or a duration with a unit.
+func (v *secondsValue) Set(s string) error {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		*v = secondsValue(seconds * float64(time.Second))
+		return nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%q is neither an amount of seconds nor a duration", s)
+	}
+
+	*v = secondsValue(d)
+	return nil
+}
+
+// String returns the duration with its unit.
+func (v *secondsValue) String() string {
+	return time.Duration(*v).String()
+}
+
+// Type returns the name of the type of the value shown in the usage.
+func (v *secondsValue) Type() string {
+	return "duration"
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSecondsValue tests if both amounts of seconds and durations with units are accepted
+func TestSecondsValue(t *testing.T) {
+	var d time.Duration
+	v := newSecondsValue(time.Second, &d)
+	assert.Equal(t, time.Second, d)
+	assert.Equal(t, "1s", v.String())
+
+	assert.NoError(t, v.Set("0.25"))
+	assert.Equal(t, 250*time.Millisecond, d)
+
+	assert.NoError(t, v.Set("2"))
+	assert.Equal(t, 2*time.Second, d)
+
+	assert.NoError(t, v.Set("150ms"))
+	assert.Equal(t, 150*time.Millisecond, d)
+
+	assert.Error(t, v.Set("soon"))
+	assert.Equal(t, 150*time.Millisecond, d)
+}
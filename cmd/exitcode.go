@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mikaelmello/pingo/core"
+)
+
+const (
+	// exitReplied is the exit code of a run where every target replied at least once
+	exitReplied = 0
+
+	// exitNoReply is the exit code of a run where a target did not reply or exceeded a threshold
+	exitNoReply = 1
+
+	// exitError is the exit code of a run that could not be executed properly
+	exitError = 2
+)
+
+// thresholds contains the limits that make a run fail when exceeded
+type thresholds struct {
+	// maxLoss is the max packet loss, in percent, negative values disable it
+	maxLoss float64
+
+	// maxAvgRTT is the max average rtt, zero disables it
+	maxAvgRTT time.Duration
+
+	// maxP99 is the max 99th percentile of the rtts, zero disables it
+	maxP99 time.Duration
+}
+
+var limits = thresholds{
+	maxLoss: -1,
+}
+
+// validate returns an error if the thresholds are not valid
+func (t *thresholds) validate() error {
+	if t.maxLoss > 100 {
+		return fmt.Errorf("max loss must be a percentage smaller than or equal to 100")
+	}
+
+	if t.maxAvgRTT < 0 {
+		return fmt.Errorf("max avg rtt must be non-negative")
+	}
+
+	if t.maxP99 < 0 {
+		return fmt.Errorf("max p99 must be non-negative")
+	}
+
+	return nil
+}
+
+// violations returns a description of every threshold exceeded by the stats
+func (t *thresholds) violations(stats core.Statistics) []string {
+	var violations []string
+
+	if loss := stats.GetPktLoss() * 100; t.maxLoss >= 0 && loss > t.maxLoss {
+		violations = append(violations, fmt.Sprintf("packet loss %.1f%% exceeds max loss %.1f%%", loss, t.maxLoss))
+	}
+
+	if avg := time.Duration(stats.GetRTTAvg()); t.maxAvgRTT > 0 && avg > t.maxAvgRTT {
+		violations = append(violations, fmt.Sprintf("avg rtt %s exceeds max avg rtt %s", avg, t.maxAvgRTT))
+	}
+
+	if p99 := time.Duration(stats.GetRTTPercentile(99)); t.maxP99 > 0 && p99 > t.maxP99 {
+		violations = append(violations, fmt.Sprintf("p99 rtt %s exceeds max p99 %s", p99, t.maxP99))
+	}
+
+	return violations
+}
+
+// exitCode returns the exit code of a finished run given the error it returned, printing the reason of a failure.
+func exitCode(sessions []*core.Session, err error, t thresholds) int {
+	if err != nil {
+		return exitError
+	}
+
+	code := exitReplied
+	for _, s := range sessions {
+		if s.Stats.GetTotalRecv() == 0 {
+			code = exitNoReply
+		}
+
+		for _, violation := range t.violations(s.Stats) {
+			println(fmt.Sprintf("%s: %s", s.CNAME(), violation))
+			code = exitNoReply
+		}
+	}
+
+	return code
+}
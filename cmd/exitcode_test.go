@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mikaelmello/pingo/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// buildSession returns a session whose stats contain sent requests and replies with the given rtts
+func buildSession(t *testing.T, sent int, rtts ...time.Duration) *core.Session {
+	s, err := core.NewSession("localhost", core.DefaultSettings())
+	assert.NoError(t, err)
+
+	for i := 0; i < sent; i++ {
+		s.Stats.EchoRequested()
+	}
+	for _, rtt := range rtts {
+		s.Stats.EchoReplied(uint64(rtt))
+	}
+
+	return s
+}
+
+// TestExitCodeError tests if errors take precedence over everything else
+func TestExitCodeError(t *testing.T) {
+	s := buildSession(t, 1, time.Millisecond)
+	assert.Equal(t, exitError, exitCode([]*core.Session{s}, fmt.Errorf("boom"), thresholds{maxLoss: -1}))
+}
+
+// TestExitCodeReplies tests if a single target without replies fails the run
+func TestExitCodeReplies(t *testing.T) {
+	replied := buildSession(t, 2, time.Millisecond)
+	silent := buildSession(t, 2)
+
+	assert.Equal(t, exitReplied, exitCode([]*core.Session{replied}, nil, thresholds{maxLoss: -1}))
+	assert.Equal(t, exitNoReply, exitCode([]*core.Session{silent}, nil, thresholds{maxLoss: -1}))
+	assert.Equal(t, exitNoReply, exitCode([]*core.Session{replied, silent}, nil, thresholds{maxLoss: -1}))
+}
+
+// TestThresholdsViolations tests if each threshold is only reported when exceeded
+func TestThresholdsViolations(t *testing.T) {
+	rtts := []time.Duration{}
+	for i := 1; i <= 100; i++ {
+		rtts = append(rtts, time.Duration(i)*time.Millisecond)
+	}
+	s := buildSession(t, 200, rtts...)
+
+	assert.Empty(t, (&thresholds{maxLoss: -1}).violations(s.Stats))
+	assert.Empty(t, (&thresholds{maxLoss: 50, maxAvgRTT: 51 * time.Millisecond, maxP99: 99 * time.Millisecond}).
+		violations(s.Stats))
+
+	assert.Len(t, (&thresholds{maxLoss: 49.9}).violations(s.Stats), 1)
+	assert.Len(t, (&thresholds{maxLoss: -1, maxAvgRTT: 50 * time.Millisecond}).violations(s.Stats), 1)
+	assert.Len(t, (&thresholds{maxLoss: -1, maxP99: 98 * time.Millisecond}).violations(s.Stats), 1)
+	assert.Len(t, (&thresholds{maxLoss: 0, maxAvgRTT: time.Millisecond, maxP99: time.Millisecond}).
+		violations(s.Stats), 3)
+
+	assert.Equal(t, exitNoReply, exitCode([]*core.Session{s}, nil, thresholds{maxLoss: 10}))
+}
+
+// TestThresholdsValidate tests if invalid thresholds are refused
+func TestThresholdsValidate(t *testing.T) {
+	assert.NoError(t, (&thresholds{maxLoss: -1}).validate())
+	assert.NoError(t, (&thresholds{maxLoss: 100}).validate())
+	assert.Error(t, (&thresholds{maxLoss: 101}).validate())
+	assert.Error(t, (&thresholds{maxLoss: -1, maxAvgRTT: -time.Second}).validate())
+	assert.Error(t, (&thresholds{maxLoss: -1, maxP99: -time.Second}).validate())
+}
@@ -9,26 +9,30 @@ import (
 
 var printMutex sync.Mutex
 
-// registerFlood registers its callbacks to be called by the session
-func registerFlood(s *core.Session) {
-	s.AddOnStart(floodPrintOnStart)
-	s.AddOnSend(floodPrintOnSend)
-	s.AddOnRecv(floodPrintOnRoundTrip)
-	s.AddOnFinish(floodPrintOnEnd)
+// floodPrinter is the observer that prints a dot per echo request and erases it when it is replied
+type floodPrinter struct {
+	core.BaseObserver
 }
 
-func floodPrintOnStart(s *core.Session, msg *icmp.Message) {
+func (p *floodPrinter) OnStart(s *core.Session, msg *icmp.Message) {
 	stdPrintOnStart(s, msg)
 }
 
-func floodPrintOnSend(s *core.Session) {
+func (p *floodPrinter) OnSend(s *core.Session, seq uint64, msg []byte) {
 	printMutex.Lock()
 	defer printMutex.Unlock()
 
 	print(".")
 }
 
-func floodPrintOnRoundTrip(s *core.Session, rt *core.RoundTrip) {
+func (p *floodPrinter) OnSendError(s *core.Session, seq uint64, err error) {
+	printMutex.Lock()
+	defer printMutex.Unlock()
+
+	print("E")
+}
+
+func (p *floodPrinter) OnRoundTrip(s *core.Session, rt *core.RoundTrip) {
 	printMutex.Lock()
 	defer printMutex.Unlock()
 
@@ -37,7 +41,7 @@ func floodPrintOnRoundTrip(s *core.Session, rt *core.RoundTrip) {
 	}
 }
 
-func floodPrintOnEnd(s *core.Session) {
+func (p *floodPrinter) OnFinish(s *core.Session) {
 	println()
 	stdPrintOnEnd(s)
 }
@@ -8,11 +8,75 @@ import (
 	"golang.org/x/net/icmp"
 )
 
-// registerStd registers its callbacks to be called by the session
-func registerStd(s *core.Session) {
-	s.AddOnStart(stdPrintOnStart)
-	s.AddOnRecv(stdPrintOnRoundTrip)
-	s.AddOnFinish(stdPrintOnEnd)
+// printOptions contains the settings of the printers, which do not affect the session itself
+type printOptions struct {
+	// timestamp defines whether lines are prefixed with the unix time
+	timestamp bool
+
+	// iso8601 defines whether lines are prefixed with the time in the ISO 8601 format
+	iso8601 bool
+
+	// outstanding defines whether requests still without a reply are reported before the next one is sent
+	outstanding bool
+
+	// quiet defines whether only the final summary is printed
+	quiet bool
+
+	// summaryFormat is the format of the final summary, one of summaryFormats
+	summaryFormat string
+}
+
+var printOpts = printOptions{
+	summaryFormat: summaryText,
+}
+
+// validate returns an error if the print options are not valid
+func (o *printOptions) validate() error {
+	_, err := summary{}.format(o.summaryFormat)
+	return err
+}
+
+// quietPrinter is the observer that prints only the final summary
+type quietPrinter struct {
+	core.BaseObserver
+}
+
+func (p *quietPrinter) OnFinish(s *core.Session) {
+	stdPrintOnEnd(s)
+}
+
+// stdPrinter is the observer that prints a line per round trip, like the classic ping
+type stdPrinter struct {
+	core.BaseObserver
+
+	// outstanding defines whether requests still without a reply are reported before the next one is sent
+	outstanding bool
+}
+
+func (p *stdPrinter) OnStart(s *core.Session, msg *icmp.Message) {
+	stdPrintOnStart(s, msg)
+}
+
+func (p *stdPrinter) OnSend(s *core.Session, seq uint64, msg []byte) {
+	if p.outstanding {
+		stdPrintOnSend(s, seq)
+	}
+}
+
+func (p *stdPrinter) OnSendError(s *core.Session, seq uint64, err error) {
+	stdPrintOnSendError(s, seq, err)
+}
+
+func (p *stdPrinter) OnRoundTrip(s *core.Session, rt *core.RoundTrip) {
+	stdPrintOnRoundTrip(s, rt)
+}
+
+func (p *stdPrinter) OnICMPError(s *core.Session, seq int, msg *icmp.Message) {
+	fmt.Printf("%sicmp_seq=%d %s\n", timestampPrefix(time.Now()), seq, msg.Type)
+}
+
+func (p *stdPrinter) OnFinish(s *core.Session) {
+	stdPrintOnEnd(s)
 }
 
 func stdPrintOnStart(s *core.Session, msg *icmp.Message) {
@@ -22,43 +86,92 @@ func stdPrintOnStart(s *core.Session, msg *icmp.Message) {
 		return
 	}
 
-	fmt.Printf("PING %s (%s) %d bytes of data\n", s.CNAME(), s.Address(), len(msgbytes))
+	settings := s.Settings()
+	from := ""
+	if settings.Interface != "" {
+		from = " from " + settings.Interface
+	}
+	if settings.Netns != "" {
+		from += " in netns " + settings.Netns
+	}
+	fmt.Printf("PING %s (%s)%s %d bytes of data, timeout %s (%s)\n", s.CNAME(), s.Address(), from, len(msgbytes),
+		settings.Timeout, settings.TimeoutPolicy)
+}
+
+func stdPrintOnSend(s *core.Session, seq uint64) {
+	if prev, ok := unansweredPrevious(s.Outstanding(), seq); ok {
+		fmt.Printf("%sno answer yet for icmp_seq=%d\n", timestampPrefix(time.Now()), prev)
+	}
+}
+
+// unansweredPrevious returns the seq of the echo request sent right before the one with the extended seq that has
+// just been sent if it is still outstanding, as iputils does, so that each lost request is only reported once.
+// The outstanding seqs are in the order they were sent, ending with the one just sent.
+func unansweredPrevious(outstanding []int, seq uint64) (int, bool) {
+	if seq <= 1 || len(outstanding) < 2 {
+		return 0, false
+	}
+
+	prev := outstanding[len(outstanding)-2]
+	return prev, prev == int(uint16(seq-1))
+}
+
+func stdPrintOnSendError(s *core.Session, seq uint64, err error) {
+	println(fmt.Sprintf("%sicmp_seq=%d %s", timestampPrefix(time.Now()), uint16(seq), err))
 }
 
 func stdPrintOnRoundTrip(s *core.Session, rt *core.RoundTrip) {
 	switch rt.Res {
 	case core.Replied:
-		fmt.Printf("%d bytes from %s: icmp_seq=%d ttl=%d time=%s\n",
-			rt.Len, rt.Src, rt.Seq, rt.TTL, rt.Time.Truncate(time.Microsecond))
+		notes := ""
+		if rt.TOSChanged {
+			notes += fmt.Sprintf(" (TOS changed to %#02x)", rt.TOS)
+		}
+		if rt.ClockDiverged {
+			notes += " (clock stepped)"
+		}
+		fmt.Printf("%s%d bytes from %s: icmp_seq=%d ttl=%d time=%s%s\n", timestampPrefix(rt.Recv),
+			rt.Len, rt.Src, rt.Seq, rt.TTL, rt.Time.Truncate(time.Microsecond), notes)
 	case core.TimedOut:
-		fmt.Printf("icmp_seq=%d time=%s timeout expired\n", rt.Seq, rt.Time)
+		fmt.Printf("%sicmp_seq=%d time=%s timeout expired\n", timestampPrefix(rt.Sent.Add(rt.Time)), rt.Seq, rt.Time)
 	case core.TTLExpired:
-		fmt.Printf("From %s: icmp_seq=%d time to live exceeded\n", rt.Src, rt.Seq)
+		fmt.Printf("%sFrom %s: icmp_seq=%d time to live exceeded\n", timestampPrefix(rt.Recv), rt.Src, rt.Seq)
+	case core.MessageTooLong:
+		fmt.Printf("%sicmp_seq=%d local error: message of %d bytes too long for the MTU\n", timestampPrefix(rt.Sent),
+			rt.Seq, rt.Len)
 	}
 }
 
-func stdPrintOnEnd(s *core.Session) {
-	println()
-	// cname, err := net.LookupCNAME(address)
+// timestampPrefix returns the prefix of a line describing an event that happened at t, according to printOpts.
+func timestampPrefix(t time.Time) string {
+	if printOpts.iso8601 {
+		return fmt.Sprintf("[%s] ", t.Format("2006-01-02T15:04:05.000000Z07:00"))
+	}
+
+	if printOpts.timestamp {
+		return fmt.Sprintf("[%d.%06d] ", t.Unix(), t.Nanosecond()/int(time.Microsecond))
+	}
+
+	return ""
+}
 
-	stTime, ok := s.Stats.GetStartTime()
-	if !ok {
+func stdPrintOnEnd(s *core.Session) {
+	if _, ok := s.Stats.GetStartTime(); !ok {
 		println("Stats were not initialized")
 	}
 
-	endTime, ok := s.Stats.GetEndTime()
-	if !ok {
+	if _, ok := s.Stats.GetEndTime(); !ok {
 		println("Stats were not initialized")
 	}
 
-	totalTime := endTime.Sub(stTime).Truncate(time.Millisecond)
-	rttMin := float64(s.Stats.GetRTTMin()) / float64(time.Millisecond)
-	rttMax := float64(s.Stats.GetRTTMax()) / float64(time.Millisecond)
-	rttAvg := float64(s.Stats.GetRTTAvg()) / float64(time.Millisecond)
-	rttMDev := float64(s.Stats.GetRTTMDev()) / float64(time.Millisecond)
+	out, err := newSummary(s).format(printOpts.summaryFormat)
+	if err != nil {
+		println(err.Error())
+		return
+	}
 
-	fmt.Printf("--- %s ping statistics ---\n", s.CNAME())
-	fmt.Printf("%d packets transmitted, %d received, %.0f%% packet loss, time %s\n",
-		s.Stats.GetTotalSent(), s.Stats.GetTotalRecv(), s.Stats.GetPktLoss()*100, totalTime)
-	fmt.Printf("rtt min/avg/max/mdev = %.3f/%.3f/%.3f/%.3f ms\n", rttMin, rttAvg, rttMax, rttMDev)
+	if printOpts.summaryFormat == summaryText {
+		println()
+	}
+	fmt.Print(out)
 }
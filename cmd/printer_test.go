@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTimestampPrefix tests if the line prefix follows the print options
+func TestTimestampPrefix(t *testing.T) {
+	defer func(opts printOptions) { printOpts = opts }(printOpts)
+
+	tstp := time.Date(2020, 5, 20, 18, 40, 1, 123456789, time.UTC)
+
+	printOpts = printOptions{}
+	assert.Equal(t, "", timestampPrefix(tstp))
+
+	printOpts = printOptions{timestamp: true}
+	assert.Equal(t, "[1590000001.123456] ", timestampPrefix(tstp))
+
+	printOpts = printOptions{timestamp: true, iso8601: true}
+	assert.Equal(t, "[2020-05-20T18:40:01.123456Z] ", timestampPrefix(tstp))
+}
+
+// TestUnansweredPrevious tests that two consecutive losses are each reported once, when the next request is sent
+func TestUnansweredPrevious(t *testing.T) {
+	// 1 and 2 are lost, 3 is answered before 4 is sent
+	sends := []struct {
+		outstanding []int
+		seq         uint64
+		prev        int
+		ok          bool
+	}{
+		{[]int{1}, 1, 0, false},
+		{[]int{1, 2}, 2, 1, true},
+		{[]int{1, 2, 3}, 3, 2, true},
+		{[]int{1, 2, 4}, 4, 0, false},
+		{[]int{4, 5}, 5, 4, true},
+	}
+
+	for _, send := range sends {
+		prev, ok := unansweredPrevious(send.outstanding, send.seq)
+		assert.Equal(t, send.ok, ok, "seq %d", send.seq)
+		if send.ok {
+			assert.Equal(t, send.prev, prev, "seq %d", send.seq)
+		}
+	}
+
+	// the 16-bit seq of the previous request wraps around
+	prev, ok := unansweredPrevious([]int{65535, 0}, 1<<16)
+	assert.True(t, ok)
+	assert.Equal(t, 65535, prev)
+}
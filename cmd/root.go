@@ -7,13 +7,30 @@ import (
 
 var (
 	settings *core.Settings
+	useTUI   bool
+	schedule = core.ScheduleFixed.String()
+
+	timeoutPolicy = core.TimeoutIPutils.String()
+
+	pmtuDisc = core.PMTUDiscDefault.String()
+
+	// dscp is the DSCP of the echo requests, setting the 6 most significant bits of the TOS
+	dscp int
+
+	// code is the exit code of the last run of the root command
+	code = exitReplied
 )
 
 var rootCmd = &cobra.Command{
-	Use:   "pingo [hostname or ip address]",
+	Use:   "pingo [hostname or ip address]...",
 	Short: "pingo, adding Go to your ping",
 	Long:  "pingo is a Go implementation of the ping utility",
-	Args:  cobra.ExactArgs(1),
+	Args: func(cmd *cobra.Command, args []string) error {
+		if useTUI {
+			return cobra.MinimumNArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
 	PreRun: func(cmd *cobra.Command, args []string) {
 		if cmd.Flags().Changed("ttl") {
 			settings.IsTTLDefault = false
@@ -26,9 +43,55 @@ var rootCmd = &cobra.Command{
 		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		r, err := newRunner(args[0], settings)
+		if err := printOpts.validate(); err != nil {
+			println(err.Error())
+			code = exitError
+			return
+		}
+
+		if err := limits.validate(); err != nil {
+			println(err.Error())
+			code = exitError
+			return
+		}
+
+		if cmd.Flags().Changed("dscp") {
+			if cmd.Flags().Changed("tos") {
+				println("the tos and dscp options can not be used together")
+				code = exitError
+				return
+			}
+			if dscp < 0 || dscp > 63 {
+				println("DSCP must be between 0 and 63")
+				code = exitError
+				return
+			}
+			settings.TOS = dscp << 2
+		}
+
+		var err error
+		if settings.Schedule, err = core.ParseSchedule(schedule); err != nil {
+			println(err.Error())
+			code = exitError
+			return
+		}
+
+		if settings.TimeoutPolicy, err = core.ParseTimeoutPolicy(timeoutPolicy); err != nil {
+			println(err.Error())
+			code = exitError
+			return
+		}
+
+		if settings.PMTUDisc, err = core.ParsePMTUDisc(pmtuDisc); err != nil {
+			println(err.Error())
+			code = exitError
+			return
+		}
+
+		r, err := newRunner(args, settings, useTUI)
 		if err != nil {
 			println(err.Error())
+			code = exitError
 			return
 		}
 
@@ -37,6 +100,8 @@ var rootCmd = &cobra.Command{
 		if err != nil {
 			println(err.Error())
 		}
+
+		code = exitCode(r.sessions, err, limits)
 	},
 }
 
@@ -44,25 +109,106 @@ func init() {
 	settings = core.DefaultSettings()
 
 	rootCmd.Flags().IntVarP(&settings.TTL, "ttl", "t", settings.TTL, "Set the IP Time to Live.")
+	rootCmd.Flags().IntVarP(&settings.PayloadSize, "size", "s", settings.PayloadSize,
+		"Specifies the number of data bytes to be sent, at least the 24 bytes used to match replies and measure round trips.")
 	rootCmd.Flags().IntVarP(&settings.MaxCount, "count", "c", settings.MaxCount,
 		"Stop after sending count ECHO_REQUEST packets. With deadline option, ping waits for count ECHO_REPLY packets, until the timeout expires.")
-	rootCmd.Flags().Float64VarP(&settings.Interval, "interval", "i", settings.Interval,
-		"Wait interval seconds between sending each packet. The default is to wait for one second between each packet normally.")
-	rootCmd.Flags().IntVarP(&settings.Timeout, "timeout", "W", settings.Timeout,
-		"Time to wait for a response, in seconds. The option affects only timeout in absence of any responses, otherwise ping waits for two RTTs.")
-	rootCmd.Flags().IntVarP(&settings.Deadline, "deadline", "w", settings.Deadline,
-		"Specify a timeout, in seconds, before ping exits regardless of how many packets have been sent or received. In this case ping does not stop after count packet are sent, it waits either for deadline expire or until count probes are answered or for some error notification from network.")
+	rootCmd.Flags().VarP(newSecondsValue(settings.Interval, &settings.Interval), "interval", "i",
+		"Wait interval between sending each packet, in seconds or as a duration, e.g. 250ms. The default is to wait for one second between each packet normally.")
+	rootCmd.Flags().VarP(newSecondsValue(settings.Timeout, &settings.Timeout), "timeout", "W",
+		"Time to wait for a response, in seconds or as a duration, e.g. 250ms. Depending on the timeout policy, the option affects only timeout in absence of any responses.")
+	rootCmd.Flags().StringVar(&timeoutPolicy, "timeout-policy", timeoutPolicy,
+		"How the time to wait for each response is computed: fixed (always the timeout), iputils (twice the largest "+
+			"RTT once a response is received) or rfc6298 (the smoothed RTT plus four times its variation, at least "+
+			"1s, once a response is received, as TCP does).")
+	rootCmd.Flags().VarP(newSecondsValue(settings.Deadline, &settings.Deadline), "deadline", "w",
+		"Specify a timeout, in seconds or as a duration, before ping exits regardless of how many packets have been sent or received. In this case ping does not stop after count packet are sent, it waits either for deadline expire or until count probes are answered or for some error notification from network.")
+	rootCmd.Flags().Var(newSecondsValue(settings.Linger, &settings.Linger), "linger",
+		"Time to wait for the pending responses after the last ECHO_REQUEST packet is sent with the count option, "+
+			"in seconds or as a duration, e.g. 500ms. Zero waits until each of them times out. Ignored with the deadline option.")
 	rootCmd.Flags().BoolVarP(&settings.Flood, "flood", "f", settings.Flood,
 		"Flood ping. For every ECHO_REQUEST sent a period '.' is printed, while for ever "+
 			"ECHO_REPLY received a backspace is printed. This provides a rapid display of how many "+
 			"packets are being dropped. It sets interval to 0.01s between packets. Only available in "+
 			"privileged mode.")
+	rootCmd.Flags().StringVar(&schedule, "schedule", schedule,
+		"Spacing of the ECHO_REQUEST packets, whose mean is the interval: fixed, jitter (uniformly distributed "+
+			"within --jitter of the interval) or poisson (exponentially distributed, as in RFC 2330).")
+	rootCmd.Flags().Float64Var(&settings.Jitter, "jitter", settings.Jitter,
+		"Fraction of the interval by which the jitter schedule randomly shortens or lengthens each interval, from "+
+			"0 to 1.")
+	rootCmd.Flags().Int64Var(&settings.Seed, "seed", settings.Seed,
+		"Seed of the random intervals of the jitter and poisson schedules, making them reproducible. Zero uses a "+
+			"random seed.")
+	rootCmd.Flags().BoolVarP(&settings.Adaptive, "adaptive", "A", settings.Adaptive,
+		"Adaptive ping. The interval adapts to the round trip time, so that no more than one ECHO_REQUEST is "+
+			"unanswered at a time. The minimal interval is 0.2s, or 0.01s in privileged mode.")
+	rootCmd.Flags().IntVarP(&settings.Preload, "preload", "l", settings.Preload,
+		"Send this many ECHO_REQUEST packets back-to-back before the interval schedule. The summary shows the loss "+
+			"of the burst apart from the rest. Only available in privileged mode.")
+	rootCmd.Flags().IntVarP(&settings.TOS, "tos", "Q", settings.TOS,
+		"Set the type of service of the ECHO_REQUEST packets, or their traffic class for IPv6, from 0 to 255, e.g. "+
+			"0xb8. Replies whose DSCP differs from it are flagged.")
+	rootCmd.Flags().IntVar(&dscp, "dscp", dscp,
+		"Set the DSCP of the ECHO_REQUEST packets, from 0 to 63, e.g. 46 for expedited forwarding. Same as --tos "+
+			"with the value shifted left by 2 bits.")
+	rootCmd.Flags().IntVar(&settings.FlowLabel, "flow-label", settings.FlowLabel,
+		"Set the flow label of the IPv6 ECHO_REQUEST packets, from 0 to 1048575. Only available on Linux.")
+	rootCmd.Flags().StringVarP(&pmtuDisc, "pmtudisc", "M", pmtuDisc,
+		"Path MTU discovery policy: do (set the Don't Fragment flag and never fragment), want (fragment packets "+
+			"larger than the path MTU), dont (never set the Don't Fragment flag), probe (set the Don't Fragment flag "+
+			"ignoring the path MTU) or default (the system policy). Packets too long to be sent are reported apart "+
+			"from other errors. Only available on Linux.")
+	rootCmd.Flags().Uint32Var(&settings.Mark, "mark", settings.Mark,
+		"Set the firewall mark of the ECHO_REQUEST packets, so that policy routing rules can select their routing "+
+			"table. Requires the CAP_NET_ADMIN capability. Only available on Linux.")
+	rootCmd.Flags().StringVar(&settings.VRF, "vrf", settings.VRF,
+		"Name of the VRF device whose routing table the ECHO_REQUEST packets use. Can be combined with a source "+
+			"address in --interface. Only available on Linux.")
+	rootCmd.Flags().StringVar(&settings.Netns, "netns", settings.Netns,
+		"Name of the network namespace, as in ip netns, or path of a network namespace, e.g. /proc/PID/ns/net, in "+
+			"which the ICMP socket is created. Names are still resolved in the current namespace. A target given "+
+			"as host@NAME uses its own namespace. Only available on Linux.")
+	rootCmd.Flags().StringVarP(&settings.Interface, "interface", "I", settings.Interface,
+		"Source IP address or name of the network interface to send the ECHO_REQUEST packets from. Names bind to the "+
+			"interface with SO_BINDTODEVICE on Linux, which may require privileges, and to its first address "+
+			"elsewhere. Also used as the zone of IPv6 link-local addresses given without one.")
 	rootCmd.Flags().BoolVarP(&settings.IsPrivileged, "privileged", "p", settings.IsPrivileged,
 		"Whether to use privileged mode. If yes, privileged raw ICMP endpoints are used, non-privileged datagram-oriented otherwise. On Linux, to run unprivileged you must enable the setting 'sudo sysctl -w net.ipv4.ping_group_range=\"0   2147483647\"'. In order to run as a privileged user, you can either run as sudo or execute 'setcap cap_net_raw=+ep <bin path>' to the path of the binary. On Windows, you must run as privileged.")
+	rootCmd.Flags().BoolVarP(&printOpts.timestamp, "timestamp", "D", printOpts.timestamp,
+		"Print timestamp (unix time + microseconds as in gettimeofday) before each line.")
+	rootCmd.Flags().BoolVar(&printOpts.iso8601, "iso8601", printOpts.iso8601,
+		"Print timestamp in the ISO 8601 format before each line, takes precedence over --timestamp.")
+	rootCmd.Flags().BoolVarP(&printOpts.outstanding, "outstanding", "O", printOpts.outstanding,
+		"Report outstanding ICMP ECHO reply before sending next packet.")
+	rootCmd.Flags().BoolVarP(&printOpts.quiet, "quiet", "q", printOpts.quiet,
+		"Quiet output. Nothing is displayed except the summary lines at the end.")
+	rootCmd.Flags().StringVar(&printOpts.summaryFormat, "summary-format", printOpts.summaryFormat,
+		"Format of the summary lines at the end: text, json (a single JSON object) or kv (a single line of "+
+			"space separated key=value pairs).")
+	rootCmd.Flags().Float64Var(&limits.maxLoss, "max-loss", limits.maxLoss,
+		"Exit with code 1 if the packet loss, in percent, exceeds this value. Negative values disable it.")
+	rootCmd.Flags().DurationVar(&limits.maxAvgRTT, "max-avg-rtt", limits.maxAvgRTT,
+		"Exit with code 1 if the average RTT exceeds this duration, e.g. 150ms. Zero disables it.")
+	rootCmd.Flags().DurationVar(&limits.maxP99, "max-p99", limits.maxP99,
+		"Exit with code 1 if the 99th percentile of the RTTs exceeds this duration, e.g. 300ms. Zero disables it.")
+	rootCmd.Flags().BoolVar(&useTUI, "tui", useTUI,
+		"Show a full-screen interactive view with a live RTT graph, a loss timeline and windowed stats instead of "+
+			"one line per reply. Accepts multiple targets, shown one row each. Keys: q quit, p pause the view, "+
+			"s pause or resume probing, r reset the windowed stats, + and - double or halve the interval.")
 	rootCmd.Flags().Uint32Var(&settings.LoggingLevel, "log-level", settings.LoggingLevel, "Logging level, goes from top priority 0 (Panic) to lowest priority 6 (Trace). Values out of this range log everything.")
 }
 
-// Execute executes the root command of the application.
-func Execute() error {
-	return rootCmd.Execute()
+// Execute executes the root command of the application and returns the exit code of the process: 0 if every
+// target replied, 1 if a target did not reply or a threshold was exceeded and 2 on errors. The check command
+// uses the monitoring plugin exit codes instead.
+func Execute() int {
+	if cmd, err := rootCmd.ExecuteC(); err != nil {
+		if cmd == checkCmd {
+			return checkUnknown
+		}
+		return exitError
+	}
+
+	return code
 }
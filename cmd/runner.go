@@ -3,6 +3,8 @@ package cmd
 import (
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/mikaelmello/pingo/core"
@@ -10,56 +12,184 @@ import (
 
 // Runner is the struct that is responsible for running the program
 type Runner struct {
-	session *core.Session
-	sigch   chan os.Signal
-	endch   chan error
+	sessions []*core.Session
+	tui      *tuiPrinter
+	sigch    chan os.Signal
+	endch    chan error
+
+	// suspended contains whether the program is suspended, guarded by mutex
+	suspended bool
+
+	// suspendPaused are the sessions paused because the program was suspended, guarded by mutex
+	suspendPaused []*core.Session
+	mutex         sync.Mutex
 }
 
 // newRunner creates a runner with the initialized values
-func newRunner(addr string, settings *core.Settings) (*Runner, error) {
-	session, err := core.NewSession(addr, settings)
-	if err != nil {
-		return nil, err
+func newRunner(addrs []string, settings *core.Settings, useTUI bool) (*Runner, error) {
+	sessions := make([]*core.Session, 0, len(addrs))
+	for _, addr := range addrs {
+		// the network namespace may differ between the targets
+		sessionSettings := *settings
+
+		host, netns := splitNetns(addr)
+		if netns != "" {
+			sessionSettings.Netns = netns
+		}
+
+		session, err := core.NewSession(host, &sessionSettings)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
 	}
 
-	if settings.Flood {
-		registerFlood(session)
+	var tui *tuiPrinter
+	if useTUI {
+		tui = newTUIPrinter(sessions, settings.Interval)
+	} else if printOpts.quiet {
+		sessions[0].AddObserver(&quietPrinter{})
+	} else if settings.Flood {
+		sessions[0].AddObserver(&floodPrinter{})
 	} else {
-		registerStd(session)
+		sessions[0].AddObserver(&stdPrinter{outstanding: printOpts.outstanding})
 	}
 
 	return &Runner{
-		session: session,
-		sigch:   make(chan os.Signal, 1),
-		endch:   make(chan error, 1),
+		sessions: sessions,
+		tui:      tui,
+		sigch:    make(chan os.Signal, 1),
+		endch:    make(chan error, len(sessions)),
 	}, nil
 }
 
+// splitNetns splits a target given as host@netns into the host and the network namespace to ping it from, which is
+// empty if the target has none.
+func splitNetns(addr string) (string, string) {
+	i := strings.LastIndex(addr, "@")
+	if i < 0 {
+		return addr, ""
+	}
+
+	return addr[:i], addr[i+1:]
+}
+
 // Start starts the runner
 func (r *Runner) Start() {
 	r.handleSignals()
 
-	go func() {
-		err := r.session.Run()
-		r.endch <- err
-	}()
+	if r.tui != nil {
+		r.tui.start(r)
+	}
+
+	for _, session := range r.sessions {
+		go func(session *core.Session) {
+			err := session.Run()
+			r.endch <- err
+		}(session)
+	}
 }
 
-// RequestStop requests the stop of the session
+// RequestStop requests the stop of all sessions
 func (r *Runner) RequestStop() {
-	r.session.RequestStop()
+	for _, session := range r.sessions {
+		session.RequestStop()
+	}
+}
+
+// Pause stops sending echo requests in all sessions that are not paused yet
+func (r *Runner) Pause() {
+	for _, session := range r.sessions {
+		if !session.IsPaused() {
+			_ = session.Pause()
+		}
+	}
 }
 
-// Wait blocks the caller until the runner finishes
+// Resume sends echo requests again in all sessions that are paused
+func (r *Runner) Resume() {
+	for _, session := range r.sessions {
+		if session.IsPaused() {
+			_ = session.Resume()
+		}
+	}
+}
+
+// IsPaused returns whether all sessions are paused
+func (r *Runner) IsPaused() bool {
+	for _, session := range r.sessions {
+		if !session.IsPaused() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// suspend pauses the sessions and gives the terminal back before the program is stopped by a SIGTSTP
+func (r *Runner) suspend() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.suspended {
+		return
+	}
+	r.suspended = true
+
+	// sessions paused by the user are not resumed when the program continues
+	r.suspendPaused = nil
+	for _, session := range r.sessions {
+		if !session.IsPaused() && session.Pause() == nil {
+			r.suspendPaused = append(r.suspendPaused, session)
+		}
+	}
+
+	if r.tui != nil {
+		r.tui.suspend()
+	}
+}
+
+// resume takes the terminal over again and resumes the sessions paused by suspend after a SIGCONT
+func (r *Runner) resume() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.tui != nil {
+		r.tui.resume()
+	}
+
+	if r.suspended {
+		r.suspended = false
+		for _, session := range r.suspendPaused {
+			_ = session.Resume()
+		}
+		r.suspendPaused = nil
+	}
+}
+
+// Wait blocks the caller until the runner finishes, returning the first error of any session
 func (r *Runner) Wait() error {
-	return <-r.endch
+	var firstErr error
+	for range r.sessions {
+		if err := <-r.endch; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if r.tui != nil {
+		r.tui.stop()
+	}
+
+	return firstErr
 }
 
-// handleSignals registers
+// handleSignals registers the handlers of the signals that stop and suspend the program
 func (r *Runner) handleSignals() {
 	signal.Notify(r.sigch, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-r.sigch
 		r.RequestStop()
 	}()
+
+	r.handleJobControl()
 }
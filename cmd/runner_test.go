@@ -11,18 +11,19 @@ import (
 
 // TestNewRunner tests if a runner is properly initialized
 func TestNewRunner(t *testing.T) {
-	r, err := newRunner("localhost", core.DefaultSettings())
+	r, err := newRunner([]string{"localhost"}, core.DefaultSettings(), false)
 	assert.NoError(t, err)
 
 	// TODO(checkadd): Mock add handler calls to check if we are actually adding the printer handlers
-	assert.NotNil(t, r.session)
+	assert.Len(t, r.sessions, 1)
+	assert.Nil(t, r.tui)
 	assert.Empty(t, r.endch)
 	assert.Empty(t, r.sigch)
 }
 
 // TestRequestStopWaitStops tests if when a runner is stopped, the session has really finished
 func TestRequestStopWaitStops(t *testing.T) {
-	r, err := newRunner("localhost", core.DefaultSettings())
+	r, err := newRunner([]string{"localhost"}, core.DefaultSettings(), false)
 	assert.NoError(t, err)
 
 	r.Start()
@@ -36,8 +37,8 @@ func TestRequestStopWaitStops(t *testing.T) {
 	select {
 	case err := <-ch:
 		assert.NoError(t, err)
-		assert.True(t, r.session.IsStarted())
-		assert.True(t, r.session.IsFinished())
+		assert.True(t, r.sessions[0].IsStarted())
+		assert.True(t, r.sessions[0].IsFinished())
 	case <-time.After(time.Second):
 		assert.Fail(t, "Requesting stop of session did not stop session")
 	}
@@ -45,7 +46,7 @@ func TestRequestStopWaitStops(t *testing.T) {
 
 // TestSigTermHandling tests if the sigterm signal really stops the run
 func TestSigTermHandling(t *testing.T) {
-	r, err := newRunner("localhost", core.DefaultSettings())
+	r, err := newRunner([]string{"localhost"}, core.DefaultSettings(), false)
 	assert.NoError(t, err)
 
 	r.Start()
@@ -65,3 +66,55 @@ func TestSigTermHandling(t *testing.T) {
 		assert.Fail(t, "Sigterm did not end run on time")
 	}
 }
+
+// TestSuspendResume tests if suspending pauses the sessions and only the sessions it paused are resumed
+func TestSuspendResume(t *testing.T) {
+	r, err := newRunner([]string{"localhost", "localhost"}, core.DefaultSettings(), false)
+	assert.NoError(t, err)
+
+	r.suspend()
+	assert.True(t, r.IsPaused())
+
+	r.resume()
+	assert.False(t, r.IsPaused())
+	assert.False(t, r.sessions[0].IsPaused())
+
+	r.Pause()
+	r.suspend()
+	r.resume()
+	assert.True(t, r.IsPaused(), "sessions paused before the suspension must stay paused")
+}
+
+// TestSuspendResumePartlyPaused tests if a session paused by the user stays paused after a suspension while the others
+// are resumed
+func TestSuspendResumePartlyPaused(t *testing.T) {
+	r, err := newRunner([]string{"localhost", "localhost", "localhost"}, core.DefaultSettings(), false)
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.sessions[1].Pause())
+
+	r.suspend()
+	assert.True(t, r.IsPaused())
+
+	r.resume()
+	assert.False(t, r.sessions[0].IsPaused())
+	assert.True(t, r.sessions[1].IsPaused(), "the session paused by the user must stay paused")
+	assert.False(t, r.sessions[2].IsPaused())
+
+	r.suspend()
+	r.suspend()
+	r.resume()
+	assert.False(t, r.sessions[0].IsPaused(), "suspending twice must not forget the sessions paused the first time")
+	assert.True(t, r.sessions[1].IsPaused())
+}
+
+// TestSplitNetns tests if the network namespace of a target is split from its host
+func TestSplitNetns(t *testing.T) {
+	host, netns := splitNetns("example.com")
+	assert.Equal(t, "example.com", host)
+	assert.Empty(t, netns)
+
+	host, netns = splitNetns("fe80::1%eth0@blue")
+	assert.Equal(t, "fe80::1%eth0", host)
+	assert.Equal(t, "blue", netns)
+}
@@ -0,0 +1,34 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package cmd
+
+import (
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+)
+
+// handleJobControl pauses the sessions when the program is suspended, e.g. with Ctrl+Z, and resumes them when it
+// continues, so that the time spent suspended is neither probed nor counted as packet loss.
+func (r *Runner) handleJobControl() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, unix.SIGTSTP, unix.SIGCONT)
+
+	go func() {
+		for sig := range ch {
+			switch sig {
+			case unix.SIGTSTP:
+				r.suspend()
+
+				// the default action of the signal actually stops the program
+				signal.Reset(unix.SIGTSTP)
+				_ = unix.Kill(os.Getpid(), unix.SIGTSTP)
+			case unix.SIGCONT:
+				signal.Notify(ch, unix.SIGTSTP)
+				r.resume()
+			}
+		}
+	}()
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mikaelmello/pingo/core"
+)
+
+const (
+	// summaryText is the classic, human readable, summary format
+	summaryText = "text"
+
+	// summaryJSON is the summary format with a single JSON object
+	summaryJSON = "json"
+
+	// summaryKeyValue is the summary format with a single line of space separated key=value pairs
+	summaryKeyValue = "kv"
+)
+
+// summaryFormats are all valid summary formats
+var summaryFormats = []string{summaryText, summaryJSON, summaryKeyValue}
+
+// summary contains the final statistics of a session
+type summary struct {
+	Target        string  `json:"target"`
+	Address       string  `json:"address"`
+	TimeoutPolicy string  `json:"timeout_policy"`
+	Transmitted   uint32  `json:"transmitted"`
+	Received      uint32  `json:"received"`
+	TimedOut      uint32  `json:"timed_out"`
+	TTLExpired    uint32  `json:"ttl_expired"`
+	Errors        uint32  `json:"errors"`
+	TooLong       uint32  `json:"message_too_long"`
+	Pending       uint32  `json:"pending"`
+	PacketLoss    float64 `json:"packet_loss_percent"`
+	Time          float64 `json:"time_ms"`
+	Paused        float64 `json:"paused_ms"`
+	RTTMin        float64 `json:"rtt_min_ms"`
+	RTTAvg        float64 `json:"rtt_avg_ms"`
+	RTTMax        float64 `json:"rtt_max_ms"`
+	RTTMDev       float64 `json:"rtt_mdev_ms"`
+
+	BurstTransmitted uint32  `json:"burst_transmitted"`
+	BurstReceived    uint32  `json:"burst_received"`
+	BurstLoss        float64 `json:"burst_packet_loss_percent"`
+	SteadyLoss       float64 `json:"steady_packet_loss_percent"`
+
+	// duration is the time the session was not paused, kept as a duration to be printed in the text format
+	duration time.Duration
+
+	// paused is the time the session was paused, kept as a duration to be printed in the text format
+	paused time.Duration
+}
+
+// newSummary gathers the final statistics of a session
+func newSummary(s *core.Session) summary {
+	stTime, _ := s.Stats.GetStartTime()
+	endTime, _ := s.Stats.GetEndTime()
+
+	address := ""
+	if s.Address() != nil {
+		address = s.Address().String()
+	}
+
+	paused := s.Stats.GetPausedDuration().Truncate(time.Millisecond)
+	duration := (endTime.Sub(stTime) - s.Stats.GetPausedDuration()).Truncate(time.Millisecond)
+
+	burstSent, burstRecv := s.Stats.GetBurstSent(), s.Stats.GetBurstRecv()
+
+	return summary{
+		Target:        s.CNAME(),
+		Address:       address,
+		TimeoutPolicy: s.Settings().TimeoutPolicy.String(),
+		Transmitted:   s.Stats.GetTotalSent(),
+		Received:      s.Stats.GetTotalRecv(),
+		TimedOut:      s.Stats.GetTotalTimedOut(),
+		TTLExpired:    s.Stats.GetTotalTTLExpired(),
+		Errors:        s.Stats.GetTotalErrors(),
+		TooLong:       s.Stats.GetTotalTooLong(),
+		Pending:       s.Stats.GetTotalPending(),
+		PacketLoss:    s.Stats.GetPktLoss() * 100,
+		Time:          toMilliseconds(duration),
+		Paused:        toMilliseconds(paused),
+		RTTMin:        toMilliseconds(time.Duration(s.Stats.GetRTTMin())),
+		RTTAvg:        toMilliseconds(time.Duration(s.Stats.GetRTTAvg())),
+		RTTMax:        toMilliseconds(time.Duration(s.Stats.GetRTTMax())),
+		RTTMDev:       toMilliseconds(time.Duration(s.Stats.GetRTTMDev())),
+		duration:      duration,
+		paused:        paused,
+
+		BurstTransmitted: burstSent,
+		BurstReceived:    burstRecv,
+		BurstLoss:        lossPercent(burstSent, burstRecv),
+		SteadyLoss:       lossPercent(s.Stats.GetTotalSent()-burstSent, s.Stats.GetTotalRecv()-burstRecv),
+	}
+}
+
+// text returns the summary in the classic ping format
+func (sm summary) text() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "--- %s ping statistics ---\n", sm.Target)
+	fmt.Fprintf(&b, "%d packets transmitted, %d received", sm.Transmitted, sm.Received)
+	if sm.Errors > 0 {
+		fmt.Fprintf(&b, ", +%d errors", sm.Errors)
+	}
+	if sm.TTLExpired > 0 {
+		fmt.Fprintf(&b, ", +%d ttl expired", sm.TTLExpired)
+	}
+	if sm.TooLong > 0 {
+		fmt.Fprintf(&b, ", +%d too long", sm.TooLong)
+	}
+	if sm.Pending > 0 {
+		fmt.Fprintf(&b, ", %d pending", sm.Pending)
+	}
+	fmt.Fprintf(&b, ", %.0f%% packet loss, time %s", sm.PacketLoss, sm.duration)
+	if sm.paused > 0 {
+		fmt.Fprintf(&b, ", paused %s", sm.paused)
+	}
+	b.WriteString("\n")
+	if sm.BurstTransmitted > 0 {
+		fmt.Fprintf(&b, "burst %d transmitted, %d received, %.0f%% packet loss; steady %d transmitted, %d received, "+
+			"%.0f%% packet loss\n", sm.BurstTransmitted, sm.BurstReceived, sm.BurstLoss,
+			sm.Transmitted-sm.BurstTransmitted, sm.Received-sm.BurstReceived, sm.SteadyLoss)
+	}
+	fmt.Fprintf(&b, "rtt min/avg/max/mdev = %.3f/%.3f/%.3f/%.3f ms\n", sm.RTTMin, sm.RTTAvg, sm.RTTMax, sm.RTTMDev)
+
+	return b.String()
+}
+
+// json returns the summary as a single line JSON object
+func (sm summary) json() (string, error) {
+	bytes, err := json.Marshal(sm)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal summary: %w", err)
+	}
+
+	return string(bytes) + "\n", nil
+}
+
+// keyValue returns the summary as a single line of space separated key=value pairs
+func (sm summary) keyValue() string {
+	return fmt.Sprintf("target=%s address=%s timeout_policy=%s transmitted=%d received=%d timed_out=%d ttl_expired=%d errors=%d "+
+		"message_too_long=%d pending=%d packet_loss_percent=%.3f time_ms=%.3f paused_ms=%.3f rtt_min_ms=%.3f rtt_avg_ms=%.3f "+
+		"rtt_max_ms=%.3f rtt_mdev_ms=%.3f burst_transmitted=%d burst_received=%d burst_packet_loss_percent=%.3f "+
+		"steady_packet_loss_percent=%.3f\n", sm.Target, sm.Address, sm.TimeoutPolicy, sm.Transmitted, sm.Received, sm.TimedOut,
+		sm.TTLExpired, sm.Errors, sm.TooLong, sm.Pending, sm.PacketLoss, sm.Time, sm.Paused, sm.RTTMin, sm.RTTAvg, sm.RTTMax,
+		sm.RTTMDev, sm.BurstTransmitted, sm.BurstReceived, sm.BurstLoss, sm.SteadyLoss)
+}
+
+// format returns the summary in the given format
+func (sm summary) format(format string) (string, error) {
+	switch format {
+	case summaryText:
+		return sm.text(), nil
+	case summaryJSON:
+		return sm.json()
+	case summaryKeyValue:
+		return sm.keyValue(), nil
+	default:
+		return "", fmt.Errorf("invalid summary format %q, must be one of %s", format, strings.Join(summaryFormats, ", "))
+	}
+}
+
+// lossPercent returns the percentage of the sent echo requests that were not replied
+func lossPercent(sent, recv uint32) float64 {
+	if sent == 0 {
+		return 0
+	}
+
+	return (1 - float64(recv)/float64(sent)) * 100
+}
+
+// toMilliseconds converts a duration to a float amount of milliseconds
+func toMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
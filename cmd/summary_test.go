@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// buildSummary returns a stub summary with every counter set
+func buildSummary() summary {
+	return summary{
+		Target:        "localhost.",
+		Address:       "127.0.0.1",
+		TimeoutPolicy: "iputils",
+		Transmitted:   10,
+		Received:      6,
+		TimedOut:      1,
+		TTLExpired:    2,
+		Errors:        1,
+		Pending:       0,
+		PacketLoss:    40,
+		Time:          9001,
+		RTTMin:        0.1,
+		RTTAvg:        0.2,
+		RTTMax:        0.3,
+		RTTMDev:       0.05,
+		duration:      9001 * time.Millisecond,
+		SteadyLoss:    40,
+	}
+}
+
+// TestSummaryText tests if the text summary shows the counters that are not zero
+func TestSummaryText(t *testing.T) {
+	out, err := buildSummary().format(summaryText)
+	assert.NoError(t, err)
+	assert.Equal(t, "--- localhost. ping statistics ---\n"+
+		"10 packets transmitted, 6 received, +1 errors, +2 ttl expired, 40% packet loss, time 9.001s\n"+
+		"rtt min/avg/max/mdev = 0.100/0.200/0.300/0.050 ms\n", out)
+}
+
+// TestSummaryTextPaused tests if the text summary shows the time the session was paused
+func TestSummaryTextPaused(t *testing.T) {
+	sm := buildSummary()
+	sm.Paused = 2500
+	sm.paused = 2500 * time.Millisecond
+
+	out, err := sm.format(summaryText)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "40% packet loss, time 9.001s, paused 2.5s\n")
+}
+
+// TestSummaryTextTooLong tests if the text summary shows the echo requests too long to be sent
+func TestSummaryTextTooLong(t *testing.T) {
+	sm := buildSummary()
+	sm.TooLong = 3
+
+	out, err := sm.format(summaryText)
+	assert.NoError(t, err)
+	assert.Contains(t, out, ", +2 ttl expired, +3 too long, 40% packet loss")
+}
+
+// TestSummaryTextBurst tests if the text summary shows the loss of the preload burst apart from the steady state
+func TestSummaryTextBurst(t *testing.T) {
+	sm := buildSummary()
+	sm.BurstTransmitted = 4
+	sm.BurstReceived = 1
+	sm.BurstLoss = 75
+	sm.SteadyLoss = lossPercent(6, 5)
+
+	out, err := sm.format(summaryText)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "\nburst 4 transmitted, 1 received, 75% packet loss; "+
+		"steady 6 transmitted, 5 received, 17% packet loss\n")
+}
+
+// TestLossPercent tests if the loss of nothing sent is zero
+func TestLossPercent(t *testing.T) {
+	assert.Zero(t, lossPercent(0, 0))
+	assert.Equal(t, 50.0, lossPercent(4, 2))
+}
+
+// TestSummaryJSON tests if the json summary is a single object
+func TestSummaryJSON(t *testing.T) {
+	out, err := buildSummary().format(summaryJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"target":"localhost.","address":"127.0.0.1","timeout_policy":"iputils","transmitted":10,"received":6,"timed_out":1,`+
+		`"ttl_expired":2,"errors":1,"message_too_long":0,"pending":0,"packet_loss_percent":40,"time_ms":9001,"paused_ms":0,"rtt_min_ms":0.1,`+
+		`"rtt_avg_ms":0.2,"rtt_max_ms":0.3,"rtt_mdev_ms":0.05,"burst_transmitted":0,"burst_received":0,`+
+		`"burst_packet_loss_percent":0,"steady_packet_loss_percent":40}`+"\n", out)
+}
+
+// TestSummaryKeyValue tests if the key=value summary is a single line
+func TestSummaryKeyValue(t *testing.T) {
+	out, err := buildSummary().format(summaryKeyValue)
+	assert.NoError(t, err)
+	assert.Equal(t, "target=localhost. address=127.0.0.1 timeout_policy=iputils transmitted=10 received=6 timed_out=1 ttl_expired=2 "+
+		"errors=1 message_too_long=0 pending=0 packet_loss_percent=40.000 time_ms=9001.000 paused_ms=0.000 rtt_min_ms=0.100 rtt_avg_ms=0.200 "+
+		"rtt_max_ms=0.300 rtt_mdev_ms=0.050 burst_transmitted=0 burst_received=0 burst_packet_loss_percent=0.000 "+
+		"steady_packet_loss_percent=40.000\n", out)
+}
+
+// TestSummaryInvalidFormat tests if an unknown format is refused
+func TestSummaryInvalidFormat(t *testing.T) {
+	_, err := buildSummary().format("xml")
+	assert.Error(t, err)
+
+	opts := printOptions{summaryFormat: "xml"}
+	assert.Error(t, opts.validate())
+
+	opts.summaryFormat = summaryJSON
+	assert.NoError(t, opts.validate())
+}
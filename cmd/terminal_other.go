@@ -0,0 +1,46 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// terminalState is the state of a terminal before it was modified, used to restore it later.
+type terminalState struct{}
+
+// makeCbreak is not supported on this platform.
+func makeCbreak(fd int) (*terminalState, error) {
+	return nil, fmt.Errorf("interactive terminal is not supported on %s", runtime.GOOS)
+}
+
+// restoreTerminal is not supported on this platform.
+func restoreTerminal(fd int, state *terminalState) error {
+	return fmt.Errorf("interactive terminal is not supported on %s", runtime.GOOS)
+}
+
+// terminalSize is not supported on this platform.
+func terminalSize(fd int) (width, height int, err error) {
+	return 0, 0, fmt.Errorf("interactive terminal is not supported on %s", runtime.GOOS)
+}
+
+// inputWaiter is not supported on this platform.
+type inputWaiter struct{}
+
+// newInputWaiter is not supported on this platform.
+func newInputWaiter(fd int) (*inputWaiter, error) {
+	return nil, fmt.Errorf("interactive terminal is not supported on %s", runtime.GOOS)
+}
+
+// wait is not supported on this platform.
+func (w *inputWaiter) wait() (bool, error) {
+	return false, fmt.Errorf("interactive terminal is not supported on %s", runtime.GOOS)
+}
+
+// cancel is not supported on this platform.
+func (w *inputWaiter) cancel() {}
+
+// close is not supported on this platform.
+func (w *inputWaiter) close() {}
@@ -0,0 +1,106 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminalState is the state of a terminal before it was modified, used to restore it later.
+type terminalState struct {
+	termios unix.Termios
+}
+
+// makeCbreak puts the terminal connected to fd in cbreak mode, where input is available byte by byte and is not
+// echoed, while signals such as the interrupt from Ctrl+C are still generated. It returns the previous state.
+func makeCbreak(fd int) (*terminalState, error) {
+	termios, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, fmt.Errorf("could not read terminal attributes: %w", err)
+	}
+
+	oldState := &terminalState{termios: *termios}
+
+	termios.Lflag &^= unix.ICANON | unix.ECHO
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, termios); err != nil {
+		return nil, fmt.Errorf("could not set terminal attributes: %w", err)
+	}
+
+	return oldState, nil
+}
+
+// restoreTerminal restores the terminal connected to fd to a previous state.
+func restoreTerminal(fd int, state *terminalState) error {
+	return unix.IoctlSetTermios(fd, ioctlWriteTermios, &state.termios)
+}
+
+// terminalSize returns the number of columns and rows of the terminal connected to fd.
+func terminalSize(fd int) (width, height int, err error) {
+	ws, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not read terminal size: %w", err)
+	}
+
+	return int(ws.Col), int(ws.Row), nil
+}
+
+// inputWaiter waits for the input of a terminal without reading it, so that the wait can be cancelled, as a read from
+// a terminal can not.
+type inputWaiter struct {
+	fd int
+
+	// cancelR becomes readable once cancelW is closed
+	cancelR *os.File
+	cancelW *os.File
+}
+
+// newInputWaiter creates an inputWaiter for the terminal connected to fd.
+func newInputWaiter(fd int) (*inputWaiter, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not create pipe: %w", err)
+	}
+
+	return &inputWaiter{fd: fd, cancelR: r, cancelW: w}, nil
+}
+
+// wait blocks until there is input to read, returning false once cancel is called.
+func (w *inputWaiter) wait() (bool, error) {
+	fds := []unix.PollFd{
+		{Fd: int32(w.fd), Events: unix.POLLIN},
+		{Fd: int32(w.cancelR.Fd()), Events: unix.POLLIN},
+	}
+
+	for {
+		_, err := unix.Poll(fds, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("could not wait for input: %w", err)
+		}
+
+		if fds[1].Revents != 0 {
+			return false, nil
+		}
+		if fds[0].Revents != 0 {
+			return true, nil
+		}
+	}
+}
+
+// cancel makes every wait return false, from now on.
+func (w *inputWaiter) cancel() {
+	w.cancelW.Close()
+}
+
+// close releases the resources of the waiter, once no wait is in progress.
+func (w *inputWaiter) close() {
+	w.cancelR.Close()
+}
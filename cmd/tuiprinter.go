@@ -0,0 +1,517 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikaelmello/pingo/core"
+	"golang.org/x/net/icmp"
+)
+
+const (
+	// tuiRefreshRate is the interval between two redraws of the screen
+	tuiRefreshRate = 250 * time.Millisecond
+
+	// tuiHistorySize is the max amount of round trips kept per target to draw the graphs
+	tuiHistorySize = 1024
+
+	// tuiWindowSize is the amount of most recent round trips used in the windowed stats
+	tuiWindowSize = 60
+
+	// tuiMinGraphHeight is the minimal height of the bar graph shown when there is a single target
+	tuiMinGraphHeight = 3
+)
+
+// sparkBlocks are the characters used to draw bars, from the lowest to the highest
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// tuiSample is a single round trip as kept by the interactive view
+type tuiSample struct {
+	res core.RoundTripResult
+	rtt time.Duration
+}
+
+// tuiRow contains everything the interactive view shows about a single target
+type tuiRow struct {
+	session  *core.Session
+	name     string
+	samples  []tuiSample
+	finished bool
+}
+
+// tuiPrinter is a full-screen interactive view of one or more running sessions
+type tuiPrinter struct {
+	core.BaseObserver
+
+	mutex     sync.Mutex
+	rows      []*tuiRow
+	bySession map[*core.Session]*tuiRow
+	interval  time.Duration
+	paused    bool
+	suspended bool
+	status    string
+
+	in        *os.File
+	out       io.Writer
+	termState *terminalState
+
+	// input waits for keys to read from in, nil if keys are not listened to
+	input *inputWaiter
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newTUIPrinter creates an interactive view and registers its callbacks to be called by the sessions
+func newTUIPrinter(sessions []*core.Session, interval time.Duration) *tuiPrinter {
+	t := &tuiPrinter{
+		bySession: make(map[*core.Session]*tuiRow, len(sessions)),
+		interval:  interval,
+		in:        os.Stdin,
+		out:       os.Stdout,
+		done:      make(chan struct{}),
+	}
+
+	for _, s := range sessions {
+		row := &tuiRow{session: s, name: "resolving..."}
+		t.rows = append(t.rows, row)
+		t.bySession[s] = row
+
+		s.AddObserver(t)
+	}
+
+	return t
+}
+
+// start takes over the terminal and starts redrawing it and listening to keys
+func (t *tuiPrinter) start(r *Runner) {
+	state, err := makeCbreak(int(t.in.Fd()))
+	if err != nil {
+		t.status = fmt.Sprintf("keybindings disabled: %s", err)
+	}
+	t.termState = state
+
+	// alternate screen buffer and hidden cursor
+	fmt.Fprint(t.out, "\x1b[?1049h\x1b[?25l")
+
+	t.wg.Add(1)
+	go t.refreshLoop()
+
+	if state != nil {
+		t.listenKeys(r)
+	}
+}
+
+// listenKeys starts reading keys from the terminal until the view is stopped
+func (t *tuiPrinter) listenKeys(r *Runner) {
+	input, err := newInputWaiter(int(t.in.Fd()))
+	if err != nil {
+		t.status = fmt.Sprintf("keybindings disabled: %s", err)
+		return
+	}
+	t.input = input
+
+	t.wg.Add(1)
+	go t.keyLoop(r)
+}
+
+// stop gives the terminal back and prints the final statistics of all sessions
+func (t *tuiPrinter) stop() {
+	close(t.done)
+	if t.input != nil {
+		t.input.cancel()
+	}
+	t.wg.Wait()
+	if t.input != nil {
+		t.input.close()
+	}
+
+	fmt.Fprint(t.out, "\x1b[?25h\x1b[?1049l")
+	if t.termState != nil {
+		_ = restoreTerminal(int(t.in.Fd()), t.termState)
+	}
+
+	for _, row := range t.rows {
+		if row.session.IsStarted() {
+			stdPrintOnEnd(row.session)
+		}
+	}
+}
+
+// suspend gives the terminal back without stopping the view, before the program is suspended
+func (t *tuiPrinter) suspend() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.suspended = true
+	fmt.Fprint(t.out, "\x1b[?25h\x1b[?1049l")
+	if t.termState != nil {
+		_ = restoreTerminal(int(t.in.Fd()), t.termState)
+	}
+}
+
+// resume takes the terminal over again after suspend
+func (t *tuiPrinter) resume() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.suspended {
+		return
+	}
+
+	if t.termState != nil {
+		// the shell may have changed the terminal attributes in the meantime
+		if _, err := makeCbreak(int(t.in.Fd())); err != nil {
+			t.status = fmt.Sprintf("keybindings disabled: %s", err)
+		}
+	}
+	fmt.Fprint(t.out, "\x1b[?1049h\x1b[?25l")
+	t.suspended = false
+}
+
+// refreshLoop redraws the screen periodically until the view is stopped
+func (t *tuiPrinter) refreshLoop() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(tuiRefreshRate)
+	defer ticker.Stop()
+
+	for {
+		t.redraw()
+
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// keyLoop reads keys from the terminal and handles them until the view is stopped, only reading once a key is
+// available so that it never stays blocked on a read after the view is stopped
+func (t *tuiPrinter) keyLoop(r *Runner) {
+	defer t.wg.Done()
+
+	buf := make([]byte, 1)
+	for {
+		ok, err := t.input.wait()
+		if err != nil || !ok {
+			return
+		}
+
+		n, err := t.in.Read(buf)
+		if err != nil {
+			return
+		}
+
+		select {
+		case <-t.done:
+			return
+		default:
+		}
+
+		if n == 1 {
+			t.handleKey(r, buf[0])
+		}
+	}
+}
+
+// handleKey executes the action bound to key
+func (t *tuiPrinter) handleKey(r *Runner, key byte) {
+	switch key {
+	case 'q':
+		t.setStatus("stopping...")
+		r.RequestStop()
+	case 'p', ' ':
+		t.mutex.Lock()
+		t.paused = !t.paused
+		t.mutex.Unlock()
+	case 's':
+		t.toggleProbing(r)
+	case 'r':
+		t.mutex.Lock()
+		for _, row := range t.rows {
+			row.samples = nil
+		}
+		t.mutex.Unlock()
+		t.setStatus("stats reset")
+	case '+', '=':
+		t.changeInterval(r, 2)
+	case '-', '_':
+		t.changeInterval(r, 0.5)
+	}
+
+	t.redraw()
+}
+
+// toggleProbing pauses sending echo requests in all sessions, or resumes it if they are all paused
+func (t *tuiPrinter) toggleProbing(r *Runner) {
+	if r.IsPaused() {
+		r.Resume()
+		t.setStatus("probing resumed")
+		return
+	}
+
+	r.Pause()
+	t.setStatus("probing paused")
+}
+
+// changeInterval multiplies the interval of all sessions by factor
+func (t *tuiPrinter) changeInterval(r *Runner, factor float64) {
+	t.mutex.Lock()
+	interval := time.Duration(float64(t.interval) * factor)
+	t.mutex.Unlock()
+
+	for _, s := range r.sessions {
+		if err := s.SetInterval(interval); err != nil {
+			t.setStatus(err.Error())
+			return
+		}
+	}
+
+	t.mutex.Lock()
+	t.interval = interval
+	t.mutex.Unlock()
+	t.setStatus(fmt.Sprintf("interval set to %s", interval))
+}
+
+// setStatus sets the message shown in the bottom of the screen
+func (t *tuiPrinter) setStatus(status string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.status = status
+}
+
+func (t *tuiPrinter) OnStart(s *core.Session, msg *icmp.Message) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.bySession[s].name = fmt.Sprintf("%s (%s)", s.CNAME(), s.Address())
+	if netns := s.Settings().Netns; netns != "" {
+		t.bySession[s].name += " @" + netns
+	}
+}
+
+func (t *tuiPrinter) OnRoundTrip(s *core.Session, rt *core.RoundTrip) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	row := t.bySession[s]
+	row.samples = append(row.samples, tuiSample{res: rt.Res, rtt: rt.Time})
+	if len(row.samples) > tuiHistorySize {
+		row.samples = row.samples[len(row.samples)-tuiHistorySize:]
+	}
+}
+
+func (t *tuiPrinter) OnFinish(s *core.Session) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.bySession[s].finished = true
+}
+
+// redraw draws the whole screen, unless the view is paused
+func (t *tuiPrinter) redraw() {
+	width, height, err := terminalSize(int(t.in.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.suspended {
+		return
+	}
+
+	if t.paused {
+		// keep the frozen screen, only the header tells it is paused
+		fmt.Fprintf(t.out, "\x1b[H%s", t.header(width))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	b.WriteString(t.header(width))
+	b.WriteString("\n\n")
+
+	graphHeight := 0
+	if len(t.rows) == 1 {
+		// header, blank line, row info, loss line, blank line and footer
+		graphHeight = height - 6
+	}
+
+	for _, row := range t.rows {
+		t.drawRow(&b, row, width, graphHeight)
+	}
+
+	b.WriteString("\n")
+	b.WriteString(truncate(" q quit  p pause view  s pause probing  r reset stats  + slower  - faster   "+t.status, width))
+
+	fmt.Fprint(t.out, b.String())
+}
+
+// header returns the first line of the screen
+func (t *tuiPrinter) header(width int) string {
+	paused := ""
+	if t.paused {
+		paused = "  [PAUSED]"
+	}
+
+	return truncate(fmt.Sprintf("pingo  %d target(s)  interval %s  %s%s", len(t.rows),
+		t.interval, time.Now().Format("15:04:05"), paused), width)
+}
+
+// drawRow draws the stats and graphs of a single target
+func (t *tuiPrinter) drawRow(b *strings.Builder, row *tuiRow, width int, graphHeight int) {
+	stats := row.session.Stats
+	state := ""
+	if row.finished {
+		state = " [finished]"
+	} else if row.session.IsPaused() {
+		state = " [paused]"
+	}
+
+	b.WriteString(truncate(fmt.Sprintf("%s%s  sent %d  recv %d  loss %.1f%%  |  last %d: %s",
+		row.name, state, stats.GetTotalSent(), stats.GetTotalRecv(), stats.GetPktLoss()*100,
+		tuiWindowSize, windowStats(row.samples)), width))
+	b.WriteString("\n")
+
+	graphWidth := width - 6
+	if graphWidth < 1 {
+		graphWidth = 1
+	}
+	samples := row.samples
+	if len(samples) > graphWidth {
+		samples = samples[len(samples)-graphWidth:]
+	}
+
+	if graphHeight >= tuiMinGraphHeight {
+		for _, line := range barGraph(samples, graphHeight) {
+			b.WriteString("      ")
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+	} else {
+		b.WriteString(" rtt  ")
+		b.WriteString(barGraph(samples, 1)[0])
+		b.WriteString("\n")
+	}
+
+	b.WriteString(" loss ")
+	b.WriteString(lossTimeline(samples))
+	b.WriteString("\n")
+}
+
+// windowStats returns a summary of the most recent samples
+func windowStats(samples []tuiSample) string {
+	if len(samples) > tuiWindowSize {
+		samples = samples[len(samples)-tuiWindowSize:]
+	}
+	if len(samples) == 0 {
+		return "no data"
+	}
+
+	var recv int
+	var sum, sqsum float64
+	rttMin, rttMax := math.MaxFloat64, 0.0
+	for _, sample := range samples {
+		if sample.res != core.Replied {
+			continue
+		}
+
+		rtt := float64(sample.rtt) / float64(time.Millisecond)
+		recv++
+		sum += rtt
+		sqsum += rtt * rtt
+		rttMin = math.Min(rttMin, rtt)
+		rttMax = math.Max(rttMax, rtt)
+	}
+
+	loss := (1 - float64(recv)/float64(len(samples))) * 100
+	if recv == 0 {
+		return fmt.Sprintf("loss %.1f%%", loss)
+	}
+
+	avg := sum / float64(recv)
+	mdev := math.Sqrt(math.Max(sqsum/float64(recv)-avg*avg, 0))
+	return fmt.Sprintf("loss %.1f%%  rtt min/avg/max/mdev %.3f/%.3f/%.3f/%.3f ms", loss, rttMin, avg, rttMax, mdev)
+}
+
+// barGraph draws the rtt of the samples as vertical bars using height lines, scaled to the largest rtt.
+// Samples without a reply are left blank.
+func barGraph(samples []tuiSample, height int) []string {
+	var rttMax time.Duration
+	for _, sample := range samples {
+		if sample.res == core.Replied && sample.rtt > rttMax {
+			rttMax = sample.rtt
+		}
+	}
+
+	levels := len(sparkBlocks)
+	lines := make([]string, height)
+	for i := range lines {
+		// the first line is the top of the graph
+		floor := (height - 1 - i) * levels
+
+		var line strings.Builder
+		for _, sample := range samples {
+			if sample.res != core.Replied || rttMax == 0 {
+				line.WriteRune(' ')
+				continue
+			}
+
+			// the smallest bar is always visible
+			eighths := int(math.Ceil(float64(sample.rtt) / float64(rttMax) * float64(height*levels)))
+			switch {
+			case eighths <= floor:
+				line.WriteRune(' ')
+			case eighths >= floor+levels:
+				line.WriteRune(sparkBlocks[levels-1])
+			default:
+				line.WriteRune(sparkBlocks[eighths-floor-1])
+			}
+		}
+		lines[i] = line.String()
+	}
+
+	return lines
+}
+
+// lossTimeline draws one character per sample, marking replies, timeouts, TTL expiries and requests too long, and
+// any other result with a question mark so that every sample keeps its place
+func lossTimeline(samples []tuiSample) string {
+	var line strings.Builder
+	for _, sample := range samples {
+		switch sample.res {
+		case core.Replied:
+			line.WriteRune('.')
+		case core.TimedOut:
+			line.WriteRune('x')
+		case core.TTLExpired:
+			line.WriteRune('T')
+		case core.MessageTooLong:
+			line.WriteRune('M')
+		default:
+			line.WriteRune('?')
+		}
+	}
+
+	return line.String()
+}
+
+// truncate cuts s so it fits in width columns
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if width <= 0 || len(runes) <= width {
+		return s
+	}
+
+	return string(runes[:width])
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mikaelmello/pingo/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBarGraph tests if bars are scaled to the largest rtt and lost samples are blank
+func TestBarGraph(t *testing.T) {
+	samples := []tuiSample{
+		{res: core.Replied, rtt: 8 * time.Millisecond},
+		{res: core.TimedOut, rtt: time.Second},
+		{res: core.Replied, rtt: 4 * time.Millisecond},
+		{res: core.Replied, rtt: 16 * time.Millisecond},
+	}
+
+	assert.Equal(t, []string{"▄ ▂█"}, barGraph(samples, 1))
+	assert.Equal(t, []string{"   █", "█ ▄█"}, barGraph(samples, 2))
+}
+
+// TestBarGraphNoReplies tests if a graph without replies is blank
+func TestBarGraphNoReplies(t *testing.T) {
+	samples := []tuiSample{
+		{res: core.TimedOut, rtt: time.Second},
+		{res: core.TTLExpired},
+	}
+
+	assert.Equal(t, []string{"  "}, barGraph(samples, 1))
+}
+
+// TestLossTimeline tests if each result is properly marked
+func TestLossTimeline(t *testing.T) {
+	samples := []tuiSample{
+		{res: core.Replied},
+		{res: core.TimedOut},
+		{res: core.TTLExpired},
+		{res: core.MessageTooLong},
+		{res: core.Replied},
+		{res: core.RoundTripResult(9)},
+		{res: core.Replied},
+	}
+
+	assert.Equal(t, ".xTM.?.", lossTimeline(samples))
+}
+
+// TestWindowStats tests if only the most recent samples are used
+func TestWindowStats(t *testing.T) {
+	assert.Equal(t, "no data", windowStats(nil))
+
+	samples := []tuiSample{}
+	for i := 0; i < tuiWindowSize; i++ {
+		samples = append(samples, tuiSample{res: core.TimedOut})
+	}
+	assert.Equal(t, "loss 100.0%", windowStats(samples))
+
+	for i := 0; i < tuiWindowSize/2; i++ {
+		samples = append(samples, tuiSample{res: core.Replied, rtt: 2 * time.Millisecond})
+	}
+	assert.Equal(t, "loss 50.0%  rtt min/avg/max/mdev 2.000/2.000/2.000/0.000 ms", windowStats(samples))
+}
+
+// TestTruncate tests if strings are cut by columns and not bytes
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "abc", truncate("abc", 5))
+	assert.Equal(t, "ab", truncate("abc", 2))
+	assert.Equal(t, "▁▂", truncate("▁▂▃", 2))
+}
+
+// TestKeyLoopStop tests if keys are handled until the view is stopped, and no longer read afterwards
+func TestKeyLoopStop(t *testing.T) {
+	in, keys, err := os.Pipe()
+	assert.NoError(t, err)
+	defer in.Close()
+	defer keys.Close()
+
+	tui := newTUIPrinter(nil, time.Second)
+	tui.in, tui.out = in, ioutil.Discard
+	tui.listenKeys(nil)
+	if tui.input == nil {
+		t.Skip(tui.status)
+	}
+
+	_, err = keys.Write([]byte("r"))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		tui.mutex.Lock()
+		defer tui.mutex.Unlock()
+		return tui.status == "stats reset"
+	}, time.Second, time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		tui.stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the view did not stop while waiting for keys")
+	}
+
+	_, err = keys.Write([]byte("p"))
+	assert.NoError(t, err)
+
+	buf := make([]byte, 1)
+	_, err = in.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, byte('p'), buf[0], "the key was read by the stopped view")
+	assert.False(t, tui.paused)
+}
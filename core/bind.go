@@ -0,0 +1,114 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// binding is the source address or the network interface the connection of a session is bound to.
+type binding struct {
+	// source is the address echo requests are sent from, nil to let the system choose it
+	source *net.IPAddr
+
+	// device is the name of the interface echo requests are sent through, empty to let the system choose it
+	device string
+
+	// vrf is the name of the VRF device whose routing table echo requests use, empty for the default one
+	vrf string
+}
+
+// parseInterface parses the interface setting, either a source IP address, with a zone if it is link-local, or the
+// name of a network interface.
+func parseInterface(val string) (binding, error) {
+	if val == "" {
+		return binding{}, nil
+	}
+
+	if ip, zone := splitZone(val); ip != nil {
+		return binding{source: &net.IPAddr{IP: ip, Zone: zone}}, nil
+	}
+
+	if _, err := net.InterfaceByName(val); err != nil {
+		return binding{}, fmt.Errorf("interface %q is neither an IP address nor a network interface: %w", val, err)
+	}
+
+	return binding{device: val}, nil
+}
+
+// splitZone parses an IP address optionally followed by %zone, returning a nil ip if it is not one.
+func splitZone(val string) (ip net.IP, zone string) {
+	host := val
+	if i := strings.LastIndexByte(val, '%'); i >= 0 {
+		host, zone = val[:i], val[i+1:]
+	}
+
+	return net.ParseIP(host), zone
+}
+
+// setVRF binds to the VRF device with the given name, which can be combined with a source address but not with an
+// interface, as an interface already belongs to a VRF.
+func (b *binding) setVRF(name string) error {
+	if name == "" {
+		return nil
+	}
+
+	if b.device != "" {
+		return fmt.Errorf("interface %s and VRF %s can not be both set, the interface already belongs to a VRF",
+			b.device, name)
+	}
+
+	if _, err := net.InterfaceByName(name); err != nil {
+		return fmt.Errorf("could not find VRF %s: %w", name, err)
+	}
+
+	b.vrf = name
+	return nil
+}
+
+// boundDevice returns the device the socket is bound to, the interface or the VRF if any.
+func (b *binding) boundDevice() string {
+	if b.device != "" {
+		return b.device
+	}
+
+	return b.vrf
+}
+
+// bindTo checks that the binding can be used to reach ipaddr, filling the zones the binding implies.
+func (b *binding) bindTo(ipaddr *net.IPAddr) error {
+	ipv4 := isIPv4(ipaddr.IP)
+	if b.source != nil && isIPv4(b.source.IP) != ipv4 {
+		return fmt.Errorf("source address %s and address %s are not of the same IP version", b.source, ipaddr)
+	}
+
+	// IPv6 link-local addresses are only meaningful on a given interface
+	if ipv4 || !ipaddr.IP.IsLinkLocalUnicast() {
+		return nil
+	}
+
+	if ipaddr.Zone == "" && b.device != "" {
+		ipaddr.Zone = b.device
+	}
+	if ipaddr.Zone == "" && b.source != nil {
+		ipaddr.Zone = b.source.Zone
+	}
+	if ipaddr.Zone == "" {
+		return fmt.Errorf("link-local address %s requires a zone, e.g. %s%%eth0, or an interface", ipaddr, ipaddr)
+	}
+
+	if b.source != nil && b.source.Zone == "" && b.source.IP.IsLinkLocalUnicast() {
+		b.source.Zone = ipaddr.Zone
+	}
+
+	return nil
+}
+
+// listenAddress returns the address the connection listens on, the source address if any.
+func (b *binding) listenAddress() string {
+	if b.source == nil {
+		return ""
+	}
+
+	return b.source.String()
+}
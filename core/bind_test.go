@@ -0,0 +1,132 @@
+package core
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseInterface verifies that the interface setting is parsed as a source address or an interface name
+func TestParseInterface(t *testing.T) {
+	bind, err := parseInterface("")
+	assert.NoError(t, err)
+	assert.Equal(t, binding{}, bind)
+
+	bind, err = parseInterface("127.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", bind.source.String())
+	assert.Empty(t, bind.device)
+
+	bind, err = parseInterface("fe80::1%eth0")
+	assert.NoError(t, err)
+	assert.Equal(t, "fe80::1", bind.source.IP.String())
+	assert.Equal(t, "eth0", bind.source.Zone)
+
+	ifaces, err := net.Interfaces()
+	assert.NoError(t, err)
+	if len(ifaces) > 0 {
+		bind, err = parseInterface(ifaces[0].Name)
+		assert.NoError(t, err)
+		assert.Nil(t, bind.source)
+		assert.Equal(t, ifaces[0].Name, bind.device)
+	}
+
+	_, err = parseInterface("not-an-interface0")
+	assert.Error(t, err)
+}
+
+// TestBindToVersion verifies that a source address must be of the IP version of the target
+func TestBindToVersion(t *testing.T) {
+	bind := binding{source: &net.IPAddr{IP: net.ParseIP("127.0.0.1")}}
+	assert.NoError(t, bind.bindTo(&net.IPAddr{IP: net.ParseIP("10.0.0.1")}))
+	assert.Error(t, bind.bindTo(&net.IPAddr{IP: net.ParseIP("::1")}))
+
+	bind = binding{source: &net.IPAddr{IP: net.ParseIP("::1")}}
+	assert.Error(t, bind.bindTo(&net.IPAddr{IP: net.ParseIP("10.0.0.1")}))
+}
+
+// TestBindToZone verifies that IPv6 link-local addresses get their zone from the binding
+func TestBindToZone(t *testing.T) {
+	ipaddr := &net.IPAddr{IP: net.ParseIP("fe80::1"), Zone: "eth1"}
+	bind := binding{device: "eth0"}
+	assert.NoError(t, bind.bindTo(ipaddr))
+	assert.Equal(t, "eth1", ipaddr.Zone, "an explicit zone must be kept")
+
+	ipaddr = &net.IPAddr{IP: net.ParseIP("fe80::1")}
+	assert.NoError(t, bind.bindTo(ipaddr))
+	assert.Equal(t, "eth0", ipaddr.Zone)
+
+	ipaddr = &net.IPAddr{IP: net.ParseIP("fe80::1")}
+	bind = binding{source: &net.IPAddr{IP: net.ParseIP("fe80::2"), Zone: "eth2"}}
+	assert.NoError(t, bind.bindTo(ipaddr))
+	assert.Equal(t, "eth2", ipaddr.Zone)
+
+	ipaddr = &net.IPAddr{IP: net.ParseIP("fe80::1"), Zone: "eth3"}
+	bind = binding{source: &net.IPAddr{IP: net.ParseIP("fe80::2")}}
+	assert.NoError(t, bind.bindTo(ipaddr))
+	assert.Equal(t, "eth3", bind.source.Zone, "the source must get the zone of the target")
+
+	ipaddr = &net.IPAddr{IP: net.ParseIP("fe80::1")}
+	bind = binding{}
+	assert.Error(t, bind.bindTo(ipaddr), "a link-local address requires a zone")
+
+	ipaddr = &net.IPAddr{IP: net.ParseIP("2001:db8::1")}
+	bind = binding{device: "eth0"}
+	assert.NoError(t, bind.bindTo(ipaddr))
+	assert.Empty(t, ipaddr.Zone, "only link-local addresses have zones")
+}
+
+// TestListenAddress verifies the address the connection listens on
+func TestListenAddress(t *testing.T) {
+	assert.Equal(t, "", (&binding{}).listenAddress())
+	assert.Equal(t, "", (&binding{device: "eth0"}).listenAddress())
+	assert.Equal(t, "fe80::1%eth0",
+		(&binding{source: &net.IPAddr{IP: net.ParseIP("fe80::1"), Zone: "eth0"}}).listenAddress())
+}
+
+// TestResolveLinkLocal verifies that link-local targets are resolved with the zone of the interface setting
+func TestResolveLinkLocal(t *testing.T) {
+	settings := DefaultSettings()
+	settings.IsPrivileged = true
+	settings.Interface = loopbackName(t)
+
+	s, err := NewSession("fe80::1", settings)
+	assert.NoError(t, err)
+	assert.NoError(t, s.resolve())
+	assert.Equal(t, settings.Interface, s.Address().(*net.IPAddr).Zone)
+	assert.Equal(t, settings.Interface, s.bind.device)
+	assert.Equal(t, "fe80::1", s.CNAME())
+}
+
+// loopbackName returns the name of the loopback interface, skipping the test if there is none
+func loopbackName(t *testing.T) string {
+	ifaces, err := net.Interfaces()
+	assert.NoError(t, err)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			return iface.Name
+		}
+	}
+
+	t.Skip("no loopback interface")
+	return ""
+}
+
+// TestBindingVRF verifies that a VRF can be combined with a source address but not with an interface
+func TestBindingVRF(t *testing.T) {
+	lo := loopbackName(t)
+
+	bind := binding{source: &net.IPAddr{IP: net.ParseIP("127.0.0.1")}}
+	assert.NoError(t, bind.setVRF(lo))
+	assert.Equal(t, lo, bind.boundDevice())
+
+	bind = binding{device: lo}
+	assert.Error(t, bind.setVRF(lo))
+	assert.Equal(t, lo, bind.boundDevice())
+
+	bind = binding{}
+	assert.Error(t, bind.setVRF("not-a-vrf0"))
+	assert.NoError(t, bind.setVRF(""))
+	assert.Empty(t, bind.boundDevice())
+}
@@ -0,0 +1,280 @@
+package core
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// monotonicOrigin is the origin of the monotonic times of the system clock.
+var monotonicOrigin = time.Now()
+
+// Clock is the source of time of a session, which reads the time, measures round trips and waits for timeouts,
+// intervals and deadlines with it.
+type Clock interface {
+	// Now returns the current time of the wall clock, which may step, e.g. when synchronized by NTP.
+	Now() time.Time
+
+	// Monotonic returns the current time of a monotonic clock, which never steps, from an arbitrary origin.
+	Monotonic() time.Duration
+
+	// NewTimer creates a timer that fires once d has elapsed.
+	NewTimer(d time.Duration) Timer
+
+	// NewTicker creates a ticker that fires every time d elapses, d must be positive.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer fires once, as a time.Timer does.
+type Timer interface {
+	// C returns the channel the time is sent on when the timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing, returning false if it has already fired or been stopped.
+	Stop() bool
+
+	// Reset makes the timer fire once d has elapsed, returning whether it was active. It must only be called on stopped
+	// or fired timers whose channel has been drained.
+	Reset(d time.Duration) bool
+}
+
+// Ticker fires periodically, as a time.Ticker does.
+type Ticker interface {
+	// C returns the channel the time is sent on when the ticker fires.
+	C() <-chan time.Time
+
+	// Stop stops the ticker.
+	Stop()
+}
+
+// SystemClock is the Clock of the system.
+type SystemClock struct{}
+
+// Now returns the current time.
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Monotonic returns the time elapsed since the program started.
+func (SystemClock) Monotonic() time.Duration {
+	return time.Since(monotonicOrigin)
+}
+
+// NewTimer creates a time.Timer.
+func (SystemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+// NewTicker creates a time.Ticker.
+func (SystemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+// systemTimer is a Timer backed by a time.Timer.
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// systemTicker is a Ticker backed by a time.Ticker.
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// ManualClock is a Clock that only moves when told to, firing its timers and tickers as it does, so that tests do not
+// depend on the passing of real time.
+type ManualClock struct {
+	mutex   sync.Mutex
+	changed *sync.Cond
+	wall    time.Time
+	mono    time.Duration
+
+	// waiters are the active timers and tickers
+	waiters []*manualWaiter
+}
+
+// NewManualClock creates a ManualClock whose wall clock starts at now.
+func NewManualClock(now time.Time) *ManualClock {
+	c := &ManualClock{wall: now}
+	c.changed = sync.NewCond(&c.mutex)
+
+	return c
+}
+
+// Now returns the current time of the wall clock.
+func (c *ManualClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.wall
+}
+
+// Monotonic returns the time the clock has advanced since it was created.
+func (c *ManualClock) Monotonic() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.mono
+}
+
+// NewTimer creates a timer that fires once the clock has advanced by d.
+func (c *ManualClock) NewTimer(d time.Duration) Timer {
+	w := &manualWaiter{clock: c, c: make(chan time.Time, 1)}
+	w.Reset(d)
+
+	return w
+}
+
+// NewTicker creates a ticker that fires every time the clock advances by d.
+func (c *ManualClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for ManualClock.NewTicker")
+	}
+
+	w := &manualWaiter{clock: c, c: make(chan time.Time, 1), period: d}
+	w.Reset(d)
+
+	return manualTicker{w}
+}
+
+// Advance moves both the wall and the monotonic clocks forward by d, firing the timers and tickers due in the order
+// they are due.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	target := c.mono + d
+	for len(c.waiters) > 0 && c.waiters[0].at <= target {
+		w := c.waiters[0]
+		c.wall = c.wall.Add(w.at - c.mono)
+		c.mono = w.at
+		c.fire(w)
+	}
+
+	c.wall = c.wall.Add(target - c.mono)
+	c.mono = target
+}
+
+// Step moves only the wall clock by d, which may be negative, as NTP may do.
+func (c *ManualClock) Step(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.wall = c.wall.Add(d)
+}
+
+// BlockUntil blocks until at least n timers and tickers are active.
+func (c *ManualClock) BlockUntil(n int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for len(c.waiters) < n {
+		c.changed.Wait()
+	}
+}
+
+// fire sends the current time to w, dropping it if the last one has not been received as time.Ticker does, and
+// schedules its next tick or deactivates it. The mutex must be held.
+func (c *ManualClock) fire(w *manualWaiter) {
+	select {
+	case w.c <- c.wall:
+	default:
+	}
+
+	c.remove(w)
+	if w.period > 0 {
+		w.at += w.period
+		c.add(w)
+	}
+}
+
+// add activates w, keeping the waiters sorted by when they are due. The mutex must be held.
+func (c *ManualClock) add(w *manualWaiter) {
+	i := sort.Search(len(c.waiters), func(i int) bool { return c.waiters[i].at > w.at })
+	c.waiters = append(c.waiters, nil)
+	copy(c.waiters[i+1:], c.waiters[i:])
+	c.waiters[i] = w
+
+	c.changed.Broadcast()
+}
+
+// remove deactivates w, returning whether it was active. The mutex must be held.
+func (c *ManualClock) remove(w *manualWaiter) bool {
+	for i, val := range c.waiters {
+		if val == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			c.changed.Broadcast()
+			return true
+		}
+	}
+
+	return false
+}
+
+// manualWaiter is a timer, or a ticker if it has a period, of a ManualClock.
+type manualWaiter struct {
+	clock  *ManualClock
+	c      chan time.Time
+	period time.Duration
+
+	// at is when the waiter is due on the monotonic clock
+	at time.Duration
+}
+
+// manualTicker is a ticker of a ManualClock.
+type manualTicker struct {
+	*manualWaiter
+}
+
+func (t manualTicker) Stop() {
+	t.manualWaiter.Stop()
+}
+
+func (w *manualWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *manualWaiter) Stop() bool {
+	w.clock.mutex.Lock()
+	defer w.clock.mutex.Unlock()
+
+	return w.clock.remove(w)
+}
+
+func (w *manualWaiter) Reset(d time.Duration) bool {
+	w.clock.mutex.Lock()
+	defer w.clock.mutex.Unlock()
+
+	active := w.clock.remove(w)
+	w.at = w.clock.mono + d
+	if d <= 0 {
+		w.clock.fire(w)
+		return active
+	}
+	w.clock.add(w)
+
+	return active
+}
+
+// instant is a time read from both the wall clock and the monotonic clock.
+type instant struct {
+	wall time.Time
+	mono time.Duration
+}
+
+// sub returns the time elapsed from j to i on the monotonic clock.
+func (i instant) sub(j instant) time.Duration {
+	return i.mono - j.mono
+}
+
+// now returns the current time of the clock of the session.
+func (s *Session) now() instant {
+	return instant{wall: s.clock.Now(), mono: s.clock.Monotonic()}
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestClock creates a ManualClock at an arbitrary time
+func newTestClock() *ManualClock {
+	return NewManualClock(time.Unix(1600000000, 0))
+}
+
+// fired returns whether ch has fired, and at which time
+func fired(ch <-chan time.Time) (time.Time, bool) {
+	select {
+	case at := <-ch:
+		return at, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// TestInstantSub tests if the time elapsed between instants is measured on the monotonic clock
+func TestInstantSub(t *testing.T) {
+	clock := newTestClock()
+	s := &Session{clock: clock}
+	start := s.now()
+	clock.Advance(3 * time.Millisecond)
+	clock.Step(-time.Hour)
+
+	assert.Equal(t, 3*time.Millisecond, s.now().sub(start))
+	assert.Equal(t, -3*time.Millisecond, start.sub(s.now()))
+}
+
+// TestSystemClock tests if the system clock reads the current time and fires its timers and tickers
+func TestSystemClock(t *testing.T) {
+	clock := SystemClock{}
+	before := time.Now()
+	first := clock.Monotonic()
+
+	assert.False(t, clock.Now().Before(before))
+	assert.GreaterOrEqual(t, int64(clock.Monotonic()), int64(first))
+
+	timer := clock.NewTimer(time.Millisecond)
+	<-timer.C()
+	assert.False(t, timer.Stop())
+	assert.False(t, timer.Reset(time.Hour))
+	assert.True(t, timer.Stop())
+
+	ticker := clock.NewTicker(time.Millisecond)
+	<-ticker.C()
+	<-ticker.C()
+	ticker.Stop()
+}
+
+// TestManualClockAdvance tests if advancing the clock moves both clocks and fires the timers due, at the time they
+// are due
+func TestManualClockAdvance(t *testing.T) {
+	clock := newTestClock()
+	start := clock.Now()
+
+	timer := clock.NewTimer(10 * time.Millisecond)
+	clock.Advance(9 * time.Millisecond)
+	_, ok := fired(timer.C())
+	assert.False(t, ok)
+
+	clock.Advance(5 * time.Millisecond)
+	at, ok := fired(timer.C())
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(10*time.Millisecond), at)
+	assert.Equal(t, start.Add(14*time.Millisecond), clock.Now())
+	assert.Equal(t, 14*time.Millisecond, clock.Monotonic())
+	assert.False(t, timer.Stop(), "a fired timer is not active")
+
+	clock.Advance(time.Hour)
+	_, ok = fired(timer.C())
+	assert.False(t, ok, "a timer fires once")
+}
+
+// TestManualClockStopReset tests if stopped timers do not fire and reset ones fire after the new duration
+func TestManualClockStopReset(t *testing.T) {
+	clock := newTestClock()
+
+	timer := clock.NewTimer(10 * time.Millisecond)
+	assert.True(t, timer.Stop())
+	clock.Advance(time.Second)
+	_, ok := fired(timer.C())
+	assert.False(t, ok)
+
+	assert.False(t, timer.Reset(5*time.Millisecond))
+	assert.True(t, timer.Reset(20*time.Millisecond))
+	clock.Advance(10 * time.Millisecond)
+	_, ok = fired(timer.C())
+	assert.False(t, ok)
+	clock.Advance(10 * time.Millisecond)
+	_, ok = fired(timer.C())
+	assert.True(t, ok)
+
+	timer.Reset(0)
+	_, ok = fired(timer.C())
+	assert.True(t, ok, "a timer reset to zero fires at once")
+}
+
+// TestManualClockTicker tests if tickers fire periodically, dropping the ticks that are not received
+func TestManualClockTicker(t *testing.T) {
+	clock := newTestClock()
+	start := clock.Now()
+
+	ticker := clock.NewTicker(10 * time.Millisecond)
+	clock.Advance(10 * time.Millisecond)
+	at, ok := fired(ticker.C())
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(10*time.Millisecond), at)
+
+	clock.Advance(35 * time.Millisecond)
+	at, ok = fired(ticker.C())
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(20*time.Millisecond), at, "later ticks are dropped until the first one is received")
+	_, ok = fired(ticker.C())
+	assert.False(t, ok)
+
+	ticker.Stop()
+	clock.Advance(time.Second)
+	_, ok = fired(ticker.C())
+	assert.False(t, ok)
+
+	assert.Panics(t, func() { clock.NewTicker(0) })
+}
+
+// TestManualClockStep tests if stepping the clock only moves the wall clock, without firing any timer
+func TestManualClockStep(t *testing.T) {
+	clock := newTestClock()
+	start := clock.Now()
+
+	timer := clock.NewTimer(time.Millisecond)
+	clock.Step(time.Hour)
+	_, ok := fired(timer.C())
+	assert.False(t, ok)
+	assert.Equal(t, start.Add(time.Hour), clock.Now())
+	assert.Zero(t, clock.Monotonic())
+}
+
+// TestManualClockBlockUntil tests if BlockUntil waits for the timers to be created
+func TestManualClockBlockUntil(t *testing.T) {
+	clock := newTestClock()
+
+	done := make(chan struct{})
+	go func() {
+		clock.BlockUntil(2)
+		close(done)
+	}()
+
+	clock.NewTimer(time.Second)
+	select {
+	case <-done:
+		t.Fatal("BlockUntil returned with a single timer")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clock.NewTicker(time.Second)
+	<-done
+}
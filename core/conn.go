@@ -0,0 +1,103 @@
+package core
+
+import (
+	"net"
+	"sync"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// readBufferSize is the size of the buffers used to read packets from the connection, that of the largest IP packet
+// so that replies are never truncated whatever the payload size.
+const readBufferSize = 65536
+
+// bufferPool keeps the buffers used to read packets from the connection, avoiding an allocation per packet.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, readBufferSize)
+		return &buffer
+	},
+}
+
+// packetConn is the connection used by a session to send echo requests and to receive replies.
+type packetConn interface {
+	// ReadFrom blocks until a packet is read into b, returning its length and the control message that came with it.
+	// It returns an error once the connection is closed.
+	ReadFrom(b []byte) (int, *controlMessage, error)
+
+	// WriteTo writes the packet b to dst.
+	WriteTo(b []byte, dst net.Addr) (int, error)
+
+	// SetTTL sets the IP Time to Live of the packets written from now on.
+	SetTTL(ttl int) error
+
+	// Close closes the connection, unblocking any ReadFrom call.
+	Close() error
+}
+
+// icmpConn is a packetConn backed by an ICMP endpoint.
+type icmpConn struct {
+	conn   net.PacketConn
+	p4     *ipv4.PacketConn
+	p6     *ipv6.PacketConn
+	isIPv4 bool
+
+	// control is the control message written with every packet, nil for none
+	control []byte
+
+	// recvControl is the buffer of the control messages read with a packet, only used by ReadFrom
+	recvControl []byte
+
+	// sendControl is the buffer of the control messages read from the error queue along with the transmit timestamps,
+	// nil if the kernel does not stamp the packets sent
+	sendControl []byte
+
+	// sendKey is the key the kernel stamps the next packet sent with, only used along with sendControl
+	sendKey uint32
+}
+
+// newICMPConn creates a packetConn backed by the ICMP endpoint conn.
+func newICMPConn(conn *icmp.PacketConn, isIPv4 bool) *icmpConn {
+	return &icmpConn{
+		conn:   conn,
+		p4:     conn.IPv4PacketConn(),
+		p6:     conn.IPv6PacketConn(),
+		isIPv4: isIPv4,
+	}
+}
+
+// WriteTo writes the packet b to dst, along with the control message of the connection if any.
+func (c *icmpConn) WriteTo(b []byte, dst net.Addr) (int, error) {
+	if c.control != nil {
+		switch conn := c.conn.(type) {
+		case *net.IPConn:
+			if addr, ok := dst.(*net.IPAddr); ok {
+				n, _, err := conn.WriteMsgIP(b, c.control, addr)
+				return n, err
+			}
+		case *net.UDPConn:
+			if addr, ok := dst.(*net.UDPAddr); ok {
+				n, _, err := conn.WriteMsgUDP(b, c.control, addr)
+				return n, err
+			}
+		}
+	}
+
+	return c.conn.WriteTo(b, dst)
+}
+
+// SetTTL sets the TTL, or the hop limit for IPv6, of the packets written from now on.
+func (c *icmpConn) SetTTL(ttl int) error {
+	if c.isIPv4 {
+		return c.p4.SetTTL(ttl)
+	}
+
+	return c.p6.SetHopLimit(ttl)
+}
+
+// Close closes the connection.
+func (c *icmpConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,210 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// recvControlSize is the size of the buffer of the control messages read with a packet.
+	recvControlSize = 256
+
+	// sendControlSize is the size of the buffer of the control messages read with a transmit timestamp.
+	sendControlSize = 128
+
+	// ipv6FlowInfo is the IPV6_FLOWINFO control message, missing from x/sys/unix.
+	ipv6FlowInfo = 0xb
+
+	// flags of SO_TIMESTAMPING, missing from x/sys/unix
+	sofTimestampingTxSoftware = 0x2
+	sofTimestampingSoftware   = 0x10
+	sofTimestampingOptID      = 0x80
+	sofTimestampingOptTSOnly  = 0x800
+
+	// sendTimestamping are the SO_TIMESTAMPING flags asking for the software transmit timestamps, keyed by the count
+	// of packets sent and without the packets themselves.
+	sendTimestamping = sofTimestampingTxSoftware | sofTimestampingSoftware | sofTimestampingOptID |
+		sofTimestampingOptTSOnly
+)
+
+// ReadFrom reads a packet from the connection along with its control messages, which are parsed here as x/net does
+// not report the TOS of IPv4 packets.
+func (c *icmpConn) ReadFrom(b []byte) (int, *controlMessage, error) {
+	var length, controlLength int
+	var src net.IP
+	var err error
+	switch conn := c.conn.(type) {
+	case *net.IPConn:
+		var addr *net.IPAddr
+		length, controlLength, _, addr, err = conn.ReadMsgIP(b, c.recvControl)
+		if addr != nil {
+			src = addr.IP
+		}
+	case *net.UDPConn:
+		var addr *net.UDPAddr
+		length, controlLength, _, addr, err = conn.ReadMsgUDP(b, c.recvControl)
+		if addr != nil {
+			src = addr.IP
+		}
+	default:
+		return 0, nil, fmt.Errorf("unsupported connection type %T", c.conn)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// raw IPv4 sockets read the IP header too
+	if _, ok := c.conn.(*net.IPConn); ok && c.isIPv4 && length > 0 {
+		headerLength := int(b[0]&0x0f) << 2
+		if headerLength > length {
+			return 0, nil, fmt.Errorf("read truncated IPv4 header of %d bytes", length)
+		}
+		length = copy(b, b[headerLength:length])
+	}
+
+	cm := &controlMessage{TOS: -1, Src: src}
+	if msgs, err := unix.ParseSocketControlMessage(c.recvControl[:controlLength]); err == nil {
+		for _, msg := range msgs {
+			parseControlMessage(cm, msg)
+		}
+	}
+
+	return length, cm, nil
+}
+
+// parseControlMessage fills cm with the info of msg, ignoring the messages it does not know.
+func parseControlMessage(cm *controlMessage, msg unix.SocketControlMessage) {
+	switch {
+	case msg.Header.Level == unix.IPPROTO_IP && msg.Header.Type == unix.IP_TTL && len(msg.Data) >= 4:
+		cm.TTL = nativeInt(msg.Data)
+	case msg.Header.Level == unix.IPPROTO_IP && msg.Header.Type == unix.IP_TOS && len(msg.Data) >= 1:
+		cm.TOS = int(msg.Data[0])
+	case msg.Header.Level == unix.IPPROTO_IPV6 && msg.Header.Type == unix.IPV6_HOPLIMIT && len(msg.Data) >= 4:
+		cm.TTL = nativeInt(msg.Data)
+	case msg.Header.Level == unix.IPPROTO_IPV6 && msg.Header.Type == unix.IPV6_TCLASS && len(msg.Data) >= 4:
+		cm.TOS = nativeInt(msg.Data)
+	case msg.Header.Level == unix.SOL_SOCKET && msg.Header.Type == unix.SCM_TIMESTAMPNS:
+		if ts, ok := timespec(msg.Data); ok {
+			cm.Timestamp = ts
+		}
+	case msg.Header.Level == unix.SOL_SOCKET && msg.Header.Type == unix.SCM_TIMESTAMPING && cm.Timestamp.IsZero():
+		// the first of the timestamps is the software one
+		if ts, ok := timespec(msg.Data); ok {
+			cm.Timestamp = ts
+		}
+	}
+}
+
+// lastSent returns the time the kernel sent the last packet written, read from the error queue of the socket where
+// the transmit timestamps are queued. Timestamps of earlier packets that arrive late are discarded.
+func (c *icmpConn) lastSent() (time.Time, bool) {
+	if c.sendControl == nil {
+		return time.Time{}, false
+	}
+
+	key := c.sendKey
+	c.sendKey++
+
+	sc, ok := c.conn.(syscall.Conn)
+	if !ok {
+		return time.Time{}, false
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var sent time.Time
+	found := false
+	// Control does not wait for the reads blocked on the socket, unlike Read
+	err = rc.Control(func(fd uintptr) {
+		for {
+			_, controlLength, _, _, err := unix.Recvmsg(int(fd), nil, c.sendControl,
+				unix.MSG_ERRQUEUE|unix.MSG_DONTWAIT)
+			if err != nil {
+				return
+			}
+
+			ts, tsKey, ok := parseSendTimestamp(c.sendControl[:controlLength])
+			// the kernel may have counted a packet that was not sent, the latest one is the last packet written
+			if ok && int32(tsKey-key) >= 0 {
+				sent, found = ts, true
+				c.sendKey = tsKey + 1
+			}
+		}
+	})
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return sent, found
+}
+
+// parseSendTimestamp returns the transmit timestamp in the control messages read from the error queue, along with
+// the key of the packet it belongs to.
+func parseSendTimestamp(control []byte) (time.Time, uint32, bool) {
+	msgs, err := unix.ParseSocketControlMessage(control)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+
+	var ts time.Time
+	var key uint32
+	hasTimestamp, hasKey := false, false
+	for _, msg := range msgs {
+		switch {
+		case msg.Header.Level == unix.SOL_SOCKET && msg.Header.Type == unix.SCM_TIMESTAMPING:
+			ts, hasTimestamp = timespec(msg.Data)
+		case (msg.Header.Level == unix.IPPROTO_IP && msg.Header.Type == unix.IP_RECVERR) ||
+			(msg.Header.Level == unix.IPPROTO_IPV6 && msg.Header.Type == unix.IPV6_RECVERR):
+			if len(msg.Data) < int(unsafe.Sizeof(unix.SockExtendedErr{})) {
+				continue
+			}
+			ee := (*unix.SockExtendedErr)(unsafe.Pointer(&msg.Data[0]))
+			if ee.Origin == unix.SO_EE_ORIGIN_TIMESTAMPING {
+				key, hasKey = ee.Data, true
+			}
+		}
+	}
+
+	return ts, key, hasTimestamp && hasKey && !ts.IsZero()
+}
+
+// timespec returns the time of the struct timespec at the start of b, false if b is too short.
+func timespec(b []byte) (time.Time, bool) {
+	if len(b) < int(unsafe.Sizeof(unix.Timespec{})) {
+		return time.Time{}, false
+	}
+
+	ts := (*unix.Timespec)(unsafe.Pointer(&b[0]))
+	if ts.Sec == 0 && ts.Nsec == 0 {
+		return time.Time{}, true
+	}
+
+	return time.Unix(ts.Unix()), true
+}
+
+// nativeInt returns the C int in native byte order at the start of b, which must have at least 4 bytes.
+func nativeInt(b []byte) int {
+	return int(*(*int32)(unsafe.Pointer(&b[0])))
+}
+
+// flowInfoMessage returns the control message setting the flow label of the IPv6 packets written with it.
+func flowInfoMessage(label int) []byte {
+	b := make([]byte, unix.CmsgSpace(4))
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&b[0]))
+	h.Level = unix.IPPROTO_IPV6
+	h.Type = ipv6FlowInfo
+	h.SetLen(unix.CmsgLen(4))
+
+	// the flow info is in network byte order, its 20 least significant bits being the flow label
+	data := b[unix.CmsgLen(0):]
+	data[0], data[1], data[2], data[3] = 0, byte(label>>16&0x0f), byte(label>>8), byte(label)
+
+	return b
+}
@@ -0,0 +1,42 @@
+//go:build !linux
+// +build !linux
+
+package core
+
+import (
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// ReadFrom reads a packet from the connection stream and gathers relevant info such as the ttl. The TOS of IPv4
+// packets is unknown, as x/net does not report it.
+func (c *icmpConn) ReadFrom(b []byte) (int, *controlMessage, error) {
+	var length int
+	var cm *controlMessage
+	var err error
+	if c.isIPv4 {
+		var cmv4 *ipv4.ControlMessage
+		length, cmv4, _, err = c.p4.ReadFrom(b)
+		if cmv4 != nil {
+			cm = &controlMessage{
+				TTL: cmv4.TTL,
+				TOS: -1,
+				Src: cmv4.Src,
+				Dst: cmv4.Dst,
+			}
+		}
+	} else {
+		var cmv6 *ipv6.ControlMessage
+		length, cmv6, _, err = c.p6.ReadFrom(b)
+		if cmv6 != nil {
+			cm = &controlMessage{
+				TTL: cmv6.HopLimit,
+				TOS: cmv6.TrafficClass,
+				Src: cmv6.Src,
+				Dst: cmv6.Dst,
+			}
+		}
+	}
+
+	return length, cm, err
+}
@@ -0,0 +1,310 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// fakeConn is an in-memory packetConn that answers every echo request with an echo reply
+type fakeConn struct {
+	isIPv4 bool
+
+	// drop returns whether the echo request with the given extended seq must not be answered, nil answers all of them
+	drop func(seq uint64) bool
+
+	// delay returns how long the reply to the echo request with the given extended seq takes, nil replies at once
+	delay func(seq uint64) time.Duration
+
+	// writeErr is returned by every write when set
+	writeErr error
+
+	// ttl is the last ttl set
+	ttl int
+
+	packets   chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newFakeConn creates a fakeConn for the given ip version
+func newFakeConn(isIPv4 bool) *fakeConn {
+	return &fakeConn{
+		isIPv4:  isIPv4,
+		packets: make(chan []byte, 1024),
+		closed:  make(chan struct{}),
+	}
+}
+
+// listenFake makes the session run over conn
+func listenFake(s *Session, conn *fakeConn) {
+	s.listen = func() (packetConn, error) {
+		return conn, nil
+	}
+}
+
+func (c *fakeConn) ReadFrom(b []byte) (int, *controlMessage, error) {
+	select {
+	case <-c.closed:
+		return 0, nil, fmt.Errorf("use of closed fake connection")
+	case pkt := <-c.packets:
+		return copy(b, pkt), &controlMessage{TTL: 64, Src: net.IPv4(127, 0, 0, 1)}, nil
+	}
+}
+
+func (c *fakeConn) WriteTo(b []byte, dst net.Addr) (int, error) {
+	if c.writeErr != nil {
+		return 0, c.writeErr
+	}
+
+	proto, replyType := 1, icmp.Type(ipv4.ICMPTypeEchoReply)
+	if !c.isIPv4 {
+		proto, replyType = 58, ipv6.ICMPTypeEchoReply
+	}
+
+	m, err := icmp.ParseMessage(proto, b)
+	if err != nil {
+		return 0, err
+	}
+
+	body, ok := m.Body.(*icmp.Echo)
+	if !ok {
+		return len(b), nil
+	}
+
+	seq := bytesToUint64(body.Data[8:16])
+	if c.drop != nil && c.drop(seq) {
+		return len(b), nil
+	}
+
+	m.Type = replyType
+	reply, err := m.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if c.delay != nil {
+		time.AfterFunc(c.delay(seq), func() { c.reply(reply) })
+		return len(b), nil
+	}
+
+	c.reply(reply)
+	return len(b), nil
+}
+
+// reply makes the reply available to be read, unless the connection is closed
+func (c *fakeConn) reply(reply []byte) {
+	select {
+	case c.packets <- reply:
+	case <-c.closed:
+	}
+}
+
+func (c *fakeConn) SetTTL(ttl int) error {
+	c.ttl = ttl
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+// TestPollConnectionClose verifies that closing the connection
+// wakes up a blocked poller without reporting an error
+func TestPollConnectionClose(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+
+	conn := newFakeConn(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	recv := make(chan *rawPacket)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go s.pollConnection(ctx, &wg, conn, recv)
+
+	cancel()
+	conn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		assert.Empty(t, s.errs)
+	case <-time.After(1 * time.Second):
+		t.Error("Poller did not return after the connection was closed")
+	}
+}
+
+// TestPollConnectionError verifies that a failed read reports an error while the run is active
+func TestPollConnectionError(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+
+	conn := newFakeConn(true)
+	conn.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	s.pollConnection(context.Background(), &wg, conn, make(chan *rawPacket))
+
+	assert.Len(t, s.errs, 1)
+}
+
+// TestSessionRunFakeConn verifies that a session runs over a fake connection until the count is reached
+func TestSessionRunFakeConn(t *testing.T) {
+	s, conn := fakeSession(t, 3)
+	conn.drop = func(seq uint64) bool { return seq == 2 }
+
+	assert.NoError(t, s.Run())
+	assert.Equal(t, uint32(3), s.Stats.GetTotalSent())
+	assert.Equal(t, uint32(2), s.Stats.GetTotalRecv())
+	assert.Equal(t, uint32(1), s.Stats.GetTotalTimedOut())
+}
+
+// TestSessionLargePayload verifies that replies with a payload larger than 256 bytes are read whole and reported
+// with their size
+func TestSessionLargePayload(t *testing.T) {
+	s, _ := fakeSession(t, 2)
+	s.settings.PayloadSize = 1000
+
+	var rts []*RoundTrip
+	s.AddOnRecv(func(_ *Session, rt *RoundTrip) {
+		rts = append(rts, rt)
+	})
+
+	assert.NoError(t, s.Run())
+	assert.Len(t, rts, 2)
+	for _, rt := range rts {
+		assert.Equal(t, Replied, rt.Res)
+		assert.Equal(t, 1000+8, rt.Len)
+	}
+}
+
+// registeredConn is a fakeConn that records whether each echo request was already waiting for its reply when it was
+// written, as a fast reply could otherwise be read before the session knows about it
+type registeredConn struct {
+	*fakeConn
+	s          *Session
+	registered []bool
+}
+
+func (c *registeredConn) WriteTo(b []byte, dst net.Addr) (int, error) {
+	_, ok := c.s.rMap.Get(c.s.lastSeq)
+	c.registered = append(c.registered, ok && len(c.s.Outstanding()) > 0)
+
+	return c.fakeConn.WriteTo(b, dst)
+}
+
+// TestSessionRegisterBeforeSend verifies that echo requests wait for their replies before they are written, so that
+// replies read right away are matched
+func TestSessionRegisterBeforeSend(t *testing.T) {
+	s, conn := fakeSession(t, 3)
+	rconn := &registeredConn{fakeConn: conn, s: s}
+	s.listen = func() (packetConn, error) {
+		return rconn, nil
+	}
+
+	assert.NoError(t, s.Run())
+	assert.Equal(t, []bool{true, true, true}, rconn.registered)
+	assert.Equal(t, uint32(3), s.Stats.GetTotalRecv())
+	assert.Equal(t, uint32(0), s.Stats.GetTotalTimedOut())
+}
+
+// TestSessionSeqWraparound verifies that replies are matched to their requests by the extended seq
+// after more than 65536 probes, even when an old request and a new one share the same 16-bit seq
+func TestSessionSeqWraparound(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+	s.isIPv4 = true
+	s.addr = &net.IPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+	// a large rtt keeps every probe from timing out while the test runs
+	s.rtt.update(time.Hour)
+
+	var mutex sync.Mutex
+	replied := make(map[uint64]*RoundTrip)
+	s.AddOnRecv(func(s *Session, rt *RoundTrip) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		replied[rt.ExtSeq] = rt
+	})
+
+	// the reply of the first probe is held back until its 16-bit seq has been reused
+	conn := newFakeConn(true)
+	conn.drop = func(seq uint64) bool { return seq == 1 }
+
+	const probes = 1<<16 + 10
+	buffer := make([]byte, readBufferSize)
+	for seq := uint64(1); seq <= probes; seq++ {
+		s.handleIntervalTimer(context.Background(), conn)
+
+		if seq != 1 {
+			length, cm, err := conn.ReadFrom(buffer)
+			assert.NoError(t, err)
+			s.handleRawPacket(&rawPacket{content: buffer, length: length, cm: cm})
+		}
+
+		if seq == 1<<16+1 {
+			late, err := buildEchoReply(s.id, 1, s.bigID, true)
+			assert.NoError(t, err)
+			s.handleRawPacket(late)
+		}
+	}
+	s.reqW.Wait()
+
+	assert.Equal(t, uint64(probes), s.lastSeq)
+	assert.Equal(t, uint32(probes), s.Stats.GetTotalSent())
+	assert.Equal(t, uint32(probes), s.Stats.GetTotalRecv())
+	assert.Len(t, replied, probes)
+	for seq, rt := range replied {
+		assert.Equal(t, Replied, rt.Res)
+		assert.Equal(t, int(uint16(seq)), rt.Seq)
+	}
+	assert.Empty(t, s.Outstanding())
+}
+
+// TestSessionSeqWraparoundLateReply verifies that a reply arriving after its request timed out
+// is not taken for a newer request with the same 16-bit seq
+func TestSessionSeqWraparoundLateReply(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+	s.isIPv4 = true
+
+	s.lastSeq = 1<<16 + 1
+	ch := s.rMap.GetOrCreate(s.lastSeq)
+	s.addOutstanding(s.lastSeq)
+
+	late, err := buildEchoReply(s.id, 1, s.bigID, true)
+	assert.NoError(t, err)
+	s.handleRawPacket(late)
+	assert.Empty(t, ch)
+
+	current, err := buildEchoReply(s.id, s.lastSeq, s.bigID, true)
+	assert.NoError(t, err)
+	s.handleRawPacket(current)
+	assert.Len(t, ch, 1)
+	assert.Equal(t, s.lastSeq, (<-ch).ExtSeq)
+
+	// time exceeded messages only carry the 16-bit seq, so they are matched to the outstanding request
+	ttl, err := buildTimeExceeded(uint16(s.id), 1, true)
+	assert.NoError(t, err)
+	s.handleRawPacket(ttl)
+	assert.Len(t, ch, 1)
+	assert.Equal(t, s.lastSeq, (<-ch).ExtSeq)
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventType is the type of a session event
+type EventType int
+
+const (
+	// EventStarted is the type of the event emitted when the session starts, after resolving its address
+	EventStarted EventType = iota
+	// EventSent is the type of the event emitted when an echo request is sent
+	EventSent
+	// EventRoundTrip is the type of the event emitted when an echo request is replied, expires or times out
+	EventRoundTrip
+	// EventError is the type of the event emitted when an echo request could not be sent or the session failed
+	EventError
+	// EventFinished is the type of the event emitted when the session ends, always the last one
+	EventFinished
+	// EventPaused is the type of the event emitted when the session stops sending echo requests after Pause
+	EventPaused
+	// EventResumed is the type of the event emitted when the session sends echo requests again after Resume
+	EventResumed
+)
+
+// String returns the name of the event type
+func (t EventType) String() string {
+	switch t {
+	case EventStarted:
+		return "started"
+	case EventSent:
+		return "sent"
+	case EventRoundTrip:
+		return "roundtrip"
+	case EventError:
+		return "error"
+	case EventFinished:
+		return "finished"
+	case EventPaused:
+		return "paused"
+	case EventResumed:
+		return "resumed"
+	default:
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+}
+
+// Event is something that happened during a session run
+type Event struct {
+	Type      EventType  // type of the event
+	Time      time.Time  // time the event happened, the time the echo request was sent for EventSent
+	Seq       uint64     // extended seq of the echo request, EventSent and errors of a single echo request only
+	RoundTrip *RoundTrip // round trip, EventRoundTrip only
+	Err       error      // error, EventError only
+}
+
+// Events returns the channel where the events of the session are delivered, in the order they happened.
+// The channel is created on the first call with the capacity of the EventBuffer setting and is closed after the
+// EventFinished event. Unless the DropEvents setting is set, the session blocks while the channel is full, so it must
+// be read until it is closed. Sessions that never had Events called do not emit any event.
+func (s *Session) Events() <-chan Event {
+	s.eventsMutex.Lock()
+	defer s.eventsMutex.Unlock()
+
+	if s.events == nil {
+		s.events = make(chan Event, s.settings.EventBuffer)
+		if s.eventsClosed {
+			// the session has already finished, there is nothing left to deliver
+			close(s.events)
+		}
+	}
+
+	return s.events
+}
+
+// DroppedEvents returns the amount of events dropped because the events channel was full.
+func (s *Session) DroppedEvents() uint64 {
+	s.eventsMutex.Lock()
+	defer s.eventsMutex.Unlock()
+
+	return s.droppedEvents
+}
+
+// emit delivers e to the events channel, if there is one, according to the DropEvents setting.
+func (s *Session) emit(e Event) {
+	s.emitMutex.Lock()
+	defer s.emitMutex.Unlock()
+
+	s.eventsMutex.Lock()
+	events, closed := s.events, s.eventsClosed
+	s.eventsMutex.Unlock()
+
+	if events == nil || closed {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = s.clock.Now()
+	}
+
+	if !s.settings.DropEvents {
+		events <- e
+		return
+	}
+
+	select {
+	case events <- e:
+	default:
+		s.eventsMutex.Lock()
+		s.droppedEvents++
+		s.eventsMutex.Unlock()
+		s.logger.Debugf("Dropping %s event as the events channel is full", e.Type)
+	}
+}
+
+// closeEvents emits the EventFinished event and closes the events channel, if there is one.
+func (s *Session) closeEvents() {
+	s.emit(Event{Type: EventFinished})
+
+	s.emitMutex.Lock()
+	defer s.emitMutex.Unlock()
+	s.eventsMutex.Lock()
+	defer s.eventsMutex.Unlock()
+
+	if s.events != nil && !s.eventsClosed {
+		close(s.events)
+	}
+	s.eventsClosed = true
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSession creates a session with count echo requests that runs over a fake connection
+func fakeSession(t *testing.T, count int) (*Session, *fakeConn) {
+	settings := DefaultSettings()
+	settings.MaxCount = count
+	settings.IsMaxCountDefault = false
+	settings.Interval = 10 * time.Millisecond
+	settings.IsPrivileged = true
+	settings.Timeout = time.Second
+	settings.TimeoutPolicy = TimeoutFixed
+
+	s, err := NewSession("localhost", settings)
+	assert.NoError(t, err)
+
+	conn := newFakeConn(true)
+	listenFake(s, conn)
+
+	return s, conn
+}
+
+// TestEventTypeString verifies the names of the event types
+func TestEventTypeString(t *testing.T) {
+	assert.Equal(t, "started", EventStarted.String())
+	assert.Equal(t, "sent", EventSent.String())
+	assert.Equal(t, "roundtrip", EventRoundTrip.String())
+	assert.Equal(t, "error", EventError.String())
+	assert.Equal(t, "finished", EventFinished.String())
+	assert.Equal(t, "EventType(42)", EventType(42).String())
+}
+
+// TestSessionEvents verifies that every event of a run is delivered in order and that the channel is closed
+func TestSessionEvents(t *testing.T) {
+	s, conn := fakeSession(t, 3)
+	conn.drop = func(seq uint64) bool { return seq == 2 }
+	s.settings.EventBuffer = 0
+
+	events := s.Events()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Run()
+	}()
+
+	var types []EventType
+	sent := make(map[uint64]bool)
+	for e := range events {
+		types = append(types, e.Type)
+		assert.False(t, e.Time.IsZero())
+
+		switch e.Type {
+		case EventSent:
+			sent[e.Seq] = true
+		case EventRoundTrip:
+			assert.True(t, sent[e.RoundTrip.ExtSeq], "round trip delivered before its echo request was sent")
+		}
+	}
+
+	assert.NoError(t, <-errs)
+	assert.Equal(t, EventStarted, types[0])
+	assert.Equal(t, EventFinished, types[len(types)-1])
+	assert.Len(t, types, 8)
+	assert.Len(t, sent, 3)
+	assert.Zero(t, s.DroppedEvents())
+}
+
+// TestSessionEventsDrop verifies that events are dropped instead of blocking the session when set
+func TestSessionEventsDrop(t *testing.T) {
+	s, _ := fakeSession(t, 3)
+	s.settings.EventBuffer = 1
+	s.settings.DropEvents = true
+
+	events := s.Events()
+	assert.NoError(t, s.Run())
+
+	e, ok := <-events
+	assert.True(t, ok)
+	assert.Equal(t, EventStarted, e.Type)
+
+	_, ok = <-events
+	assert.False(t, ok)
+	assert.Equal(t, uint64(7), s.DroppedEvents())
+}
+
+// TestSessionEventsError verifies that a failed run delivers its error before finishing
+func TestSessionEventsError(t *testing.T) {
+	s, _ := fakeSession(t, 3)
+	s.listen = func() (packetConn, error) {
+		return nil, fmt.Errorf("no connection")
+	}
+
+	events := s.Events()
+	assert.Error(t, s.Run())
+
+	var types []EventType
+	for e := range events {
+		types = append(types, e.Type)
+		if e.Type == EventError {
+			assert.EqualError(t, e.Err, "no connection")
+		}
+	}
+
+	assert.Equal(t, []EventType{EventStarted, EventError, EventFinished}, types)
+}
+
+// TestSessionEventsCanceled verifies that a canceled run finishes without an error event
+func TestSessionEventsCanceled(t *testing.T) {
+	s, _ := fakeSession(t, 100)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	events := s.Events()
+	assert.Equal(t, context.DeadlineExceeded, s.RunContext(ctx))
+
+	var last Event
+	for e := range events {
+		assert.NotEqual(t, EventError, e.Type)
+		last = e
+	}
+	assert.Equal(t, EventFinished, last.Type)
+}
+
+// TestSessionEventsAfterFinish verifies that the events channel of a finished session is closed
+func TestSessionEventsAfterFinish(t *testing.T) {
+	s, _ := fakeSession(t, 1)
+	assert.NoError(t, s.Run())
+
+	_, ok := <-s.Events()
+	assert.False(t, ok)
+}
@@ -1,8 +1,8 @@
 package core
 
 import (
+	"context"
 	"fmt"
-	"net"
 	"sync"
 	"time"
 
@@ -16,50 +16,60 @@ const (
 	ttlExceeded               = 0
 	icmpProtocol              = 1
 	icmpv6Protocol            = 58
-	dataLength                = 16
+	dataLength                = 24
+	maxPayloadSize            = 65507
 	icmpPrivilegedNetwork     = "ip4:icmp"
 	icmpv6PrivilegedNetwork   = "ip6:ipv6-icmp"
 	icmpUnprivilegedNetwork   = "udp4"
 	icmpv6UnprivilegedNetwork = "udp6"
+	ecnMask                   = 0x03
 )
 
 // sendEchoRequest sends an echo request to the address defined in the Session receiving as a parameter
-// the open connection with the target host.
-func (s *Session) sendEchoRequest(conn *icmp.PacketConn, seq int) error {
+// the open connection with the target host. It returns the time the request was sent.
+func (s *Session) sendEchoRequest(conn packetConn, seq uint64) ([]byte, instant, error) {
 	s.logger.Infof("Making a new echo request to address %s", s.addr.String())
 
 	msg := s.buildEchoRequest(seq)
 	bytesmsg, err := msg.Marshal(nil)
 	if err != nil {
-		return fmt.Errorf("could not marshal ICMP message with Echo body: %w", err)
+		return nil, instant{}, fmt.Errorf("could not marshal ICMP message with Echo body: %w", err)
 	}
 
 	s.logger.Infof("Writing ICMP message %x to address %s", bytesmsg, s.addr.String())
+	sentAt := s.now()
 	_, err = conn.WriteTo(bytesmsg, s.addr)
 
 	if err != nil {
-		return fmt.Errorf("error while sending echo request: %w", err)
+		return bytesmsg, sentAt, fmt.Errorf("error while sending echo request: %w", err)
 	}
 
-	return nil
+	return bytesmsg, sentAt, nil
 }
 
 // Builds the next ICMP package, does not modify session's state.
-func (s *Session) buildEchoRequest(seq int) *icmp.Message {
+// The 16-bit seq of the message is the extended seq truncated, which is carried in full in the payload.
+func (s *Session) buildEchoRequest(seq uint64) *icmp.Message {
 	s.logger.Tracef("Building new echo request")
 
-	now := time.Now()
+	now := s.now().wall
 	bigID := uint64ToBytes(s.bigID) // ensure same source
-	tstp := unixNanoToBytes(now)    // calculate rtt
-	data := append(bigID, tstp...)
+	extSeq := uint64ToBytes(seq)    // match replies across seq wraparounds
+	tstp := unixNanoToBytes(now)    // cross-check the rtt
+	data := append(append(bigID, extSeq...), tstp...)
+
+	// the rest of the payload is padded with a pattern, like the classic ping
+	for i := len(data); i < s.settings.PayloadSize; i++ {
+		data = append(data, byte(i))
+	}
 
 	body := &icmp.Echo{
 		ID:   s.id,
-		Seq:  seq, // verify pair of request-replies
+		Seq:  int(uint16(seq)), // verify pair of request-replies
 		Data: data,
 	}
 
-	s.logger.Tracef("Body id %d, seq %d, bigID %d, tstp %s", s.id, s.lastSeq+1, s.bigID, now)
+	s.logger.Tracef("Body id %d, seq %d, bigID %d, tstp %s", s.id, seq, s.bigID, now)
 	s.logger.Tracef("Body data %x", data)
 
 	msg := &icmp.Message{
@@ -72,88 +82,58 @@ func (s *Session) buildEchoRequest(seq int) *icmp.Message {
 	return msg
 }
 
-// pollConnection constantly polls the connection to receive and process any replies.
-func (s *Session) pollConnection(wg *sync.WaitGroup, conn *icmp.PacketConn, recv chan<- *rawPacket) {
+// pollConnection blocks on the connection to receive any replies, sending them to recv, until ctx is done.
+// The connection must be closed once ctx is done so that a blocked read returns.
+func (s *Session) pollConnection(ctx context.Context, wg *sync.WaitGroup, conn packetConn, recv chan<- *rawPacket) {
 	defer wg.Done()
 
-	// here we are sure that we will never consume a finishReqs produced by us, as we always return
-	// after producing
 	for {
-		select {
-		case <-s.finishReqs:
-			s.logger.Info("Received request to finish, ending and forwarding")
-			return
-		default:
-			buffer := make([]byte, 256)
+		buffer := bufferPool.Get().(*[]byte)
 
-			maxwait := time.Millisecond * 1
+		s.logger.Trace("Reading from connection")
+		length, cm, err := conn.ReadFrom(*buffer)
+		readAt := s.now()
+		if err != nil {
+			bufferPool.Put(buffer)
 
-			s.logger.Tracef("Setting read deadline to %s", maxwait)
-			if err := conn.SetReadDeadline(time.Now().Add(maxwait)); err != nil {
-				s.finishReqs <- fmt.Errorf("error while setting read deadline, finishing polling and session: %w", err)
+			if ctx.Err() != nil {
+				s.logger.Info("Received request to finish, ending polling")
 				return
 			}
 
-			s.logger.Trace("Reading from connection")
-			length, cm, err := s.readFrom(conn, buffer)
-			if err != nil {
-				if neterr, ok := err.(*net.OpError); ok {
-					if neterr.Timeout() {
-						s.logger.Trace("Read deadline has expired, trying again")
-						continue
-					} else {
-						// request to finish
-						s.finishReqs <- fmt.Errorf("error while reading from connection, finishing polling and session: %s", err)
-						return
-					}
-				}
-			}
-
-			// sends the packet to the session so it can be checked and processed
-			s.logger.Infof("Sending raw packet %x with ttl %d to main session loop", buffer[:length], cm.TTL)
-			recv <- &rawPacket{content: buffer, length: length, cm: cm}
+			s.reportError(fmt.Errorf("error while reading from connection, finishing polling and session: %w", err))
+			return
 		}
-	}
-}
 
-// readFrom is a wrapper meant to read bytes from the connection stream and gather relevant info such as the ttl.
-func (s *Session) readFrom(conn *icmp.PacketConn, bytes []byte) (int, *controlMessage, error) {
-	var length int
-	var cm *controlMessage
-	var err error
-	if s.isIPv4 {
-		var cmv4 *ipv4.ControlMessage
-		length, cmv4, _, err = conn.IPv4PacketConn().ReadFrom(bytes)
-		if cmv4 != nil {
-			cm = &controlMessage{
-				TTL: cmv4.TTL,
-				Src: cmv4.Src,
-				Dst: cmv4.Dst,
-			}
-		}
-	} else {
-		var cmv6 *ipv6.ControlMessage
-		length, cmv6, _, err = conn.IPv6PacketConn().ReadFrom(bytes)
-		if cmv6 != nil {
-			cm = &controlMessage{
-				TTL: cmv6.HopLimit,
-				Src: cmv6.Src,
-				Dst: cmv6.Dst,
-			}
+		// sends the packet to the session so it can be checked and processed
+		s.logger.Infof("Sending raw packet %x to main session loop", (*buffer)[:length])
+		select {
+		case recv <- &rawPacket{content: *buffer, length: length, cm: cm, readAt: readAt, buffer: buffer}:
+		case <-ctx.Done():
+			bufferPool.Put(buffer)
+			s.logger.Info("Received request to finish, ending polling")
+			return
 		}
 	}
-
-	return length, cm, err
 }
 
 // checkRawPacket returns whether the packet matches all requirements to be considered a successful reply.
 // It also modifies the Session state by updating it with info from the packet if it is considered a successful reply.
 func (s *Session) preProcessRawPacket(raw *rawPacket) (*RoundTrip, error) {
-	receivedTstp := time.Now()
+	readAt := raw.readAt
+	if readAt.wall.IsZero() {
+		readAt = s.now()
+	}
+
+	// the kernel stamps the packet as it arrives, before it waits to be read and to get here
+	receivedTstp, clock := readAt.wall, ClockUser
+	if raw.cm != nil && !raw.cm.Timestamp.IsZero() {
+		receivedTstp, clock = raw.cm.Timestamp, ClockKernelRecv
+	}
 
 	s.logger.Infof("Parsing raw packet %x as an ICMP message using protocol %d",
 		raw.content[:raw.length], s.getProtocol())
-	m, err := icmp.ParseMessage(s.getProtocol(), raw.content)
+	m, err := icmp.ParseMessage(s.getProtocol(), raw.content[:raw.length])
 	if err != nil {
 		return nil, fmt.Errorf("error parsing ICMP message: %s", err.Error())
 	}
@@ -162,6 +142,10 @@ func (s *Session) preProcessRawPacket(raw *rawPacket) (*RoundTrip, error) {
 	isTimeExceeded := m.Code == ttlExceeded &&
 		(m.Type == ipv4.ICMPTypeTimeExceeded || m.Type == ipv6.ICMPTypeTimeExceeded)
 
+	if !isEchoReply && !isTimeExceeded && isICMPError(m) {
+		return nil, s.checkICMPError(m)
+	}
+
 	if !isEchoReply && !isTimeExceeded {
 		// Not an echo reply or time exceeded, ignore it
 		s.logger.Debugf("Received message that is not an echo reply or time exceeded, code %d and type %d", m.Code, m.Type)
@@ -173,24 +157,9 @@ func (s *Session) preProcessRawPacket(raw *rawPacket) (*RoundTrip, error) {
 	case *icmp.TimeExceeded:
 		s.logger.Info("Received a TimeExceeded message")
 
-		var origdgram []byte
-		if s.isIPv4 {
-			if len(body.Data) < 28 {
-				return nil, fmt.Errorf("received TimeExceeded does not minimum length that we need."+
-					" %d bytes received of min %d", 28, len(body.Data))
-			}
-			origdgram = body.Data[20:28]
-		} else {
-			if len(body.Data) < 48 {
-				return nil, fmt.Errorf("received TimeExceeded does not minimum length that we need."+
-					" %d bytes received of min %d", 48, len(body.Data))
-			}
-			origdgram = body.Data[40:48]
-		}
-
-		echoBody := &icmp.Echo{
-			ID:  int(bytesToUint16(origdgram[4:6])),
-			Seq: int(bytesToUint16(origdgram[6:])),
+		echoBody, err := s.quotedEcho(body.Data)
+		if err != nil {
+			return nil, fmt.Errorf("received TimeExceeded %w", err)
 		}
 
 		// Check if TLE came from same ID
@@ -203,11 +172,15 @@ func (s *Session) preProcessRawPacket(raw *rawPacket) (*RoundTrip, error) {
 
 		rt := &RoundTrip{
 			TTL:  raw.cm.TTL,
+			TOS:  raw.cm.TOS,
 			Src:  raw.cm.Src,
 			Len:  raw.length,
 			Seq:  echoBody.Seq,
 			Res:  TTLExpired,
 			Time: time.Duration(0),
+			Recv: receivedTstp,
+
+			readAt: readAt,
 		}
 
 		return rt, nil
@@ -229,7 +202,8 @@ func (s *Session) preProcessRawPacket(raw *rawPacket) (*RoundTrip, error) {
 
 		// retrieve the info we serialized
 		bigID := bytesToUint64(body.Data[:8])
-		tstp := bytesToUnixNano(body.Data[8:])
+		extSeq := bytesToUint64(body.Data[8:16])
+		tstp := bytesToUnixNano(body.Data[16:24])
 
 		// checks if our unique identifier also matches
 		if bigID != s.bigID {
@@ -239,15 +213,27 @@ func (s *Session) preProcessRawPacket(raw *rawPacket) (*RoundTrip, error) {
 		}
 		s.logger.Debugf("Echo reply body data bigID matches session big ID. Expected: %d.", s.bigID)
 
-		rttduration := receivedTstp.Sub(tstp)
+		// the extended seq must agree with the seq of the header it was sent with
+		if uint16(extSeq) != uint16(body.Seq) {
+			s.logger.Debugf("Echo reply body data extended seq does not match body seq. Extended: %d. Actual: %d.",
+				extSeq, body.Seq)
+			return nil, nil
+		}
 
 		rt := &RoundTrip{
-			TTL:  raw.cm.TTL,
-			Src:  raw.cm.Src,
-			Len:  raw.length,
-			Seq:  body.Seq,
-			Res:  Replied,
-			Time: rttduration,
+			TTL:         raw.cm.TTL,
+			TOS:         raw.cm.TOS,
+			TOSChanged:  s.isTOSChanged(raw.cm.TOS),
+			Src:         raw.cm.Src,
+			Len:         raw.length,
+			Seq:         body.Seq,
+			ExtSeq:      extSeq,
+			Res:         Replied,
+			Recv:        receivedTstp,
+			Clock:       clock,
+			PayloadSent: tstp,
+
+			readAt: readAt,
 		}
 
 		return rt, nil
@@ -256,6 +242,80 @@ func (s *Session) preProcessRawPacket(raw *rawPacket) (*RoundTrip, error) {
 	}
 }
 
+// icmpErrorMessage is the error returned when parsing an ICMP error message regarding an echo request of the session.
+type icmpErrorMessage struct {
+	msg *icmp.Message
+	seq int
+}
+
+func (e *icmpErrorMessage) Error() string {
+	return fmt.Sprintf("received ICMP %v message for icmp_seq=%d", e.msg.Type, e.seq)
+}
+
+// isICMPError returns whether m is an ICMP error message, which quotes the datagram that caused it.
+func isICMPError(m *icmp.Message) bool {
+	switch m.Type {
+	case ipv4.ICMPTypeDestinationUnreachable, ipv4.ICMPTypeParameterProblem, ipv4.ICMPTypeTimeExceeded,
+		ipv6.ICMPTypeDestinationUnreachable, ipv6.ICMPTypePacketTooBig, ipv6.ICMPTypeParameterProblem,
+		ipv6.ICMPTypeTimeExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkICMPError returns an icmpErrorMessage if the ICMP error message m quotes an echo request of the session, nil if
+// it quotes something else or too little to tell.
+func (s *Session) checkICMPError(m *icmp.Message) error {
+	var data []byte
+	switch body := m.Body.(type) {
+	case *icmp.DstUnreach:
+		data = body.Data
+	case *icmp.PacketTooBig:
+		data = body.Data
+	case *icmp.ParamProb:
+		data = body.Data
+	case *icmp.TimeExceeded:
+		data = body.Data
+	default:
+		return fmt.Errorf("invalid body type: '%T'", body)
+	}
+
+	echoBody, err := s.quotedEcho(data)
+	if err != nil {
+		s.logger.Debugf("ICMP error message can not be matched to the session, it %s", err)
+		return nil
+	}
+
+	if echoBody.ID != s.id {
+		s.logger.Debugf("ICMP error message does not match session, parsed id differs. Expected: %d. Actual: %d",
+			s.id, echoBody.ID)
+		return nil
+	}
+
+	return &icmpErrorMessage{msg: m, seq: echoBody.Seq}
+}
+
+// quotedEcho returns the id and seq of the echo request quoted by an ICMP error message, which starts with the IP
+// header of the original datagram.
+func (s *Session) quotedEcho(data []byte) (*icmp.Echo, error) {
+	headerLength := 20
+	if !s.isIPv4 {
+		headerLength = 40
+	}
+
+	if len(data) < headerLength+8 {
+		return nil, fmt.Errorf("does not have the minimum length that we need. %d bytes received of min %d",
+			len(data), headerLength+8)
+	}
+	origdgram := data[headerLength : headerLength+8]
+
+	return &icmp.Echo{
+		ID:  int(bytesToUint16(origdgram[4:6])),
+		Seq: int(bytesToUint16(origdgram[6:])),
+	}, nil
+}
+
 // getICMPType returns the appropriate type to be used in the ICMP request of this session.
 func (s *Session) getICMPTypeEcho() icmp.Type {
 	if s.isIPv4 {
@@ -290,9 +350,17 @@ func (s *Session) getProtocol() int {
 }
 
 // getConnection returns a connection made to the session's address.
-func (s *Session) getConnection() (*icmp.PacketConn, error) {
+func (s *Session) getConnection() (packetConn, error) {
+	if s.isIPv4 && s.settings.FlowLabel != 0 {
+		return nil, fmt.Errorf("flow label is only available for IPv6 addresses")
+	}
+
 	s.logger.Infof("Starting to listen to packets in network %s", s.getNetwork())
-	conn, err := icmp.ListenPacket(s.getNetwork(), "")
+	var conn *icmpConn
+	err := s.inNetns(func() (err error) {
+		conn, err = s.listenPacket()
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("could not listen to ICMP packets, error: %s", err.Error())
 	}
@@ -300,23 +368,41 @@ func (s *Session) getConnection() (*icmp.PacketConn, error) {
 
 	if s.isIPv4 {
 		s.logger.Info("Setting TTL and control message to receive TTL")
-		if err := conn.IPv4PacketConn().SetTTL(s.settings.TTL); err != nil {
+		if err := conn.p4.SetTTL(s.settings.TTL); err != nil {
 			return nil, fmt.Errorf("could not set TTL in connection, error: %s", err.Error())
 		}
-		if err := conn.IPv4PacketConn().SetControlMessage(ipv4.FlagTTL, true); err != nil {
+		if err := conn.p4.SetControlMessage(ipv4.FlagTTL, true); err != nil {
 			return nil, fmt.Errorf("could not set control message in connection, error: %s", err.Error())
 		}
+		if s.settings.TOS != 0 {
+			s.logger.Infof("Setting TOS to %#02x", s.settings.TOS)
+			if err := conn.p4.SetTOS(s.settings.TOS); err != nil {
+				return nil, fmt.Errorf("could not set TOS in connection, error: %s", err.Error())
+			}
+		}
 	} else {
-		s.logger.Info("Setting TTL and control message to receive TTL")
-		if err := conn.IPv6PacketConn().SetHopLimit(s.settings.TTL); err != nil {
+		s.logger.Info("Setting TTL and control message to receive TTL and traffic class")
+		if err := conn.p6.SetHopLimit(s.settings.TTL); err != nil {
 			return nil, fmt.Errorf("could not set control message in connection, error: %s", err.Error())
 		}
-		if err := conn.IPv6PacketConn().SetControlMessage(ipv6.FlagHopLimit, true); err != nil {
+		if err := conn.p6.SetControlMessage(ipv6.FlagHopLimit|ipv6.FlagTrafficClass, true); err != nil {
 			return nil, fmt.Errorf("could not set control message in connection, error: %s", err.Error())
 		}
+		if s.settings.TOS != 0 {
+			s.logger.Infof("Setting traffic class to %#02x", s.settings.TOS)
+			if err := conn.p6.SetTrafficClass(s.settings.TOS); err != nil {
+				return nil, fmt.Errorf("could not set traffic class in connection, error: %s", err.Error())
+			}
+		}
 	}
 
 	s.logger.Debug("Connection to listen to packets successfully created and configured")
 
 	return conn, nil
 }
+
+// isTOSChanged returns whether the TOS of a reply differs from the TOS the echo requests are sent with, ignoring the
+// ECN bits that the network may legitimately change. An unknown TOS is not considered changed.
+func (s *Session) isTOSChanged(tos int) bool {
+	return tos >= 0 && tos&^ecnMask != s.settings.TOS&^ecnMask
+}
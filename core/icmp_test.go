@@ -27,6 +27,7 @@ func TestSessionBuildEchoRequest(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, s)
 
+	s.lastSeq = 0x10002
 	msg := s.buildEchoRequest(s.lastSeq)
 
 	assert.Equal(t, s.getICMPTypeEcho(), msg.Type)
@@ -35,12 +36,14 @@ func TestSessionBuildEchoRequest(t *testing.T) {
 	switch body := msg.Body.(type) {
 	case *icmp.Echo:
 		assert.Equal(t, s.id, body.ID)
-		assert.Equal(t, s.lastSeq, body.Seq)
+		assert.Equal(t, 2, body.Seq)
 
 		// retrieve the info we serialized
 		bigID := bytesToUint64(body.Data[:8])
-		tstp := bytesToUnixNano(body.Data[8:])
+		extSeq := bytesToUint64(body.Data[8:16])
+		tstp := bytesToUnixNano(body.Data[16:])
 		assert.Equal(t, s.bigID, bigID)
+		assert.Equal(t, s.lastSeq, extSeq)
 		assert.NotEqual(t, time.Time{}, tstp)
 		assert.True(t, time.Now().After(tstp))
 	default:
@@ -85,8 +88,12 @@ func TestSessionPreProcessRawPacket1(t *testing.T) {
 	assert.Equal(t, pkt.cm.Src, rt.Src)
 	assert.Equal(t, pkt.cm.TTL, rt.TTL)
 	assert.Equal(t, pkt.length, rt.Len)
-	assert.Equal(t, s.lastSeq, rt.Seq)
+	assert.Equal(t, int(s.lastSeq), rt.Seq)
+	assert.Equal(t, s.lastSeq, rt.ExtSeq)
 	assert.Equal(t, Replied, rt.Res)
+	assert.False(t, rt.PayloadSent.IsZero())
+	assert.False(t, rt.Recv.Before(rt.PayloadSent))
+	assert.Zero(t, rt.Time, "the rtt is measured once the reply is matched with its request")
 }
 
 // TestSessionPreProcessRawPacket2 verifies if an ICMP Time
@@ -108,7 +115,7 @@ func TestSessionPreProcessRawPacket2(t *testing.T) {
 	assert.Equal(t, pkt.cm.Src, rt.Src)
 	assert.Equal(t, pkt.cm.TTL, rt.TTL)
 	assert.Equal(t, pkt.length, rt.Len)
-	assert.Equal(t, s.lastSeq, rt.Seq)
+	assert.Equal(t, int(s.lastSeq), rt.Seq)
 	assert.Equal(t, TTLExpired, rt.Res)
 }
 
@@ -288,15 +295,29 @@ func TestSessionGetProtocolIPv6(t *testing.T) {
 	assert.Equal(t, icmpv6Protocol, s.getProtocol())
 }
 
+// TestSessionIsTOSChanged verifies that only DSCP changes of known TOS values are flagged
+func TestSessionIsTOSChanged(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+
+	s.settings.TOS = 0xb8
+	assert.False(t, s.isTOSChanged(0xb8))
+	assert.False(t, s.isTOSChanged(0xbb), "ECN bits must be ignored")
+	assert.False(t, s.isTOSChanged(-1), "unknown TOS must be ignored")
+	assert.True(t, s.isTOSChanged(0))
+	assert.True(t, s.isTOSChanged(0x28))
+}
+
 // buildEchoReply builds a stub echo reply
-func buildEchoReply(id int, seq int, bigID uint64, isIPv4 bool) (pkt *rawPacket, err error) {
+func buildEchoReply(id int, seq uint64, bigID uint64, isIPv4 bool) (pkt *rawPacket, err error) {
 	now := time.Now()
 	bigIDb := uint64ToBytes(bigID) // ensure same source
+	extSeq := uint64ToBytes(seq)   // match across wraparounds
 	tstp := unixNanoToBytes(now)   // calculate rtt
-	data := append(bigIDb, tstp...)
+	data := append(append(bigIDb, extSeq...), tstp...)
 	body := &icmp.Echo{
 		ID:   id,
-		Seq:  seq,
+		Seq:  int(uint16(seq)),
 		Data: data,
 	}
 
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// flowLabelSupported is whether the flow label of IPv6 packets can be set.
+	flowLabelSupported = true
+
+	// pmtuDiscSupported is whether the path MTU discovery policy can be set.
+	pmtuDiscSupported = true
+
+	// markSupported is whether the firewall mark of the socket can be set.
+	markSupported = true
+
+	// vrfSupported is whether the socket can be bound to a VRF device.
+	vrfSupported = true
+)
+
+// listenPacket listens to ICMP packets according to the binding of the session. The socket is created here instead
+// of by icmp.ListenPacket so that it can be bound to an interface or a VRF with SO_BINDTODEVICE, regardless of the
+// routing table, marked for policy routing, and so that the connection can read and write control messages x/net
+// does not know about.
+func (s *Session) listenPacket() (*icmpConn, error) {
+	family, proto := unix.AF_INET, icmpProtocol
+	if !s.isIPv4 {
+		family, proto = unix.AF_INET6, icmpv6Protocol
+	}
+
+	sa, err := s.bind.sockaddr(s.isIPv4)
+	if err != nil {
+		return nil, err
+	}
+
+	// the same kinds of sockets icmp.ListenPacket creates
+	sotype := unix.SOCK_DGRAM
+	if s.settings.IsPrivileged {
+		sotype = unix.SOCK_RAW
+	}
+
+	fd, err := unix.Socket(family, sotype|unix.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+
+	if device := s.bind.boundDevice(); device != "" {
+		s.logger.Infof("Binding to device %s", device)
+		if err := unix.BindToDevice(fd, device); err != nil {
+			unix.Close(fd)
+			return nil, fmt.Errorf("could not bind to device %s: %w", device, os.NewSyscallError("setsockopt", err))
+		}
+	}
+
+	if s.settings.Mark != 0 {
+		s.logger.Infof("Setting firewall mark to %d", s.settings.Mark)
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_MARK, int(s.settings.Mark)); err != nil {
+			unix.Close(fd)
+			return nil, fmt.Errorf("could not set firewall mark %d: %w", s.settings.Mark,
+				os.NewSyscallError("setsockopt", err))
+		}
+	}
+
+	// x/net can not ask for the TOS of IPv4 packets
+	if s.isIPv4 {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_RECVTOS, 1); err != nil {
+			unix.Close(fd)
+			return nil, os.NewSyscallError("setsockopt", err)
+		}
+	}
+
+	// the kernel stamps the packets as they arrive and leave, the session takes the times itself where it does not
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1); err != nil {
+		s.logger.Infof("Kernel receive timestamps are not available: %s", err)
+	}
+	sendTimestamps := true
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TIMESTAMPING, sendTimestamping); err != nil {
+		s.logger.Infof("Kernel transmit timestamps are not available: %s", err)
+		sendTimestamps = false
+	}
+
+	if s.settings.PMTUDisc != PMTUDiscDefault {
+		s.logger.Infof("Setting path MTU discovery policy to %s", s.settings.PMTUDisc)
+		if err := setPMTUDisc(fd, s.settings.PMTUDisc, s.isIPv4); err != nil {
+			unix.Close(fd)
+			return nil, os.NewSyscallError("setsockopt", err)
+		}
+	}
+
+	if s.bind.source != nil {
+		s.logger.Infof("Binding to source address %s", s.bind.source)
+	}
+	if err := unix.Bind(fd, sa); err != nil {
+		unix.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	f := os.NewFile(uintptr(fd), "icmp")
+	conn, err := net.FilePacketConn(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &icmpConn{conn: conn, isIPv4: s.isIPv4, recvControl: make([]byte, recvControlSize)}
+	if s.isIPv4 {
+		c.p4 = ipv4.NewPacketConn(conn)
+	} else {
+		c.p6 = ipv6.NewPacketConn(conn)
+	}
+
+	if sendTimestamps {
+		c.sendControl = make([]byte, sendControlSize)
+	}
+
+	if s.settings.FlowLabel != 0 {
+		c.control = flowInfoMessage(s.settings.FlowLabel)
+	}
+
+	return c, nil
+}
+
+// sockaddr returns the address the socket is bound to, the source address if any.
+func (b *binding) sockaddr(ipv4 bool) (unix.Sockaddr, error) {
+	if ipv4 {
+		sa := &unix.SockaddrInet4{}
+		if b.source != nil {
+			copy(sa.Addr[:], b.source.IP.To4())
+		}
+		return sa, nil
+	}
+
+	sa := &unix.SockaddrInet6{}
+	if b.source == nil {
+		return sa, nil
+	}
+
+	copy(sa.Addr[:], b.source.IP.To16())
+	if b.source.Zone == "" {
+		return sa, nil
+	}
+
+	if iface, err := net.InterfaceByName(b.source.Zone); err == nil {
+		sa.ZoneId = uint32(iface.Index)
+	} else if index, err := strconv.ParseUint(b.source.Zone, 10, 32); err == nil {
+		sa.ZoneId = uint32(index)
+	} else {
+		return nil, fmt.Errorf("invalid zone of source address %s", b.source)
+	}
+
+	return sa, nil
+}
+
+// pmtuDiscOptions are the values of IP_MTU_DISCOVER and IPV6_MTU_DISCOVER, indexed by path MTU discovery policy.
+var pmtuDiscOptions = map[PMTUDisc][2]int{
+	PMTUDiscDo:    {unix.IP_PMTUDISC_DO, unix.IPV6_PMTUDISC_DO},
+	PMTUDiscWant:  {unix.IP_PMTUDISC_WANT, unix.IPV6_PMTUDISC_WANT},
+	PMTUDiscDont:  {unix.IP_PMTUDISC_DONT, unix.IPV6_PMTUDISC_DONT},
+	PMTUDiscProbe: {unix.IP_PMTUDISC_PROBE, unix.IPV6_PMTUDISC_PROBE},
+}
+
+// setPMTUDisc sets the path MTU discovery policy of the socket fd, unless it is the default.
+func setPMTUDisc(fd int, policy PMTUDisc, ipv4 bool) error {
+	opts, ok := pmtuDiscOptions[policy]
+	if !ok {
+		return nil
+	}
+
+	if ipv4 {
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, opts[0])
+	}
+
+	return unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, opts[1])
+}
@@ -0,0 +1,236 @@
+package core
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/sys/unix"
+)
+
+// loopbackSession runs a privileged session of two echo requests to the loopback address addr with the settings
+// changed by configure and a fixed timeout, returning its round trips and skipping the test if raw sockets are not
+// permitted
+func loopbackSession(t *testing.T, addr string, configure func(*Settings)) (*Session, []*RoundTrip) {
+	settings := DefaultSettings()
+	settings.IsPrivileged = true
+	settings.MaxCount = 2
+	settings.IsMaxCountDefault = false
+	settings.Interval = 10 * time.Millisecond
+	settings.TimeoutPolicy = TimeoutFixed
+	configure(settings)
+
+	s, err := NewSession(addr, settings)
+	assert.NoError(t, err)
+
+	var rts []*RoundTrip
+	s.AddOnRecv(func(_ *Session, rt *RoundTrip) {
+		rts = append(rts, rt)
+	})
+
+	if err := s.Run(); err != nil {
+		t.Skipf("session could not run: %s", err)
+	}
+
+	return s, rts
+}
+
+// TestListenDevice verifies that echo requests are replied through the bound loopback interface
+func TestListenDevice(t *testing.T) {
+	s, _ := loopbackSession(t, "127.0.0.1", func(settings *Settings) {
+		settings.Interface = loopbackName(t)
+	})
+	assert.Equal(t, uint32(2), s.Stats.GetTotalRecv())
+}
+
+// TestListenSource verifies that echo requests are replied when sent from the loopback address
+func TestListenSource(t *testing.T) {
+	s, _ := loopbackSession(t, "127.0.0.1", func(settings *Settings) {
+		settings.Interface = "127.0.0.1"
+	})
+	assert.Equal(t, uint32(2), s.Stats.GetTotalRecv())
+}
+
+// TestListenTOS verifies that the TOS of the echo requests is reflected by the loopback replies and reported
+func TestListenTOS(t *testing.T) {
+	_, rts := loopbackSession(t, "127.0.0.1", func(settings *Settings) {
+		settings.TOS = 0xb8
+	})
+
+	assert.Len(t, rts, 2)
+	for _, rt := range rts {
+		assert.Equal(t, 0xb8, rt.TOS)
+		assert.False(t, rt.TOSChanged)
+	}
+}
+
+// TestListenTrafficClass verifies that the traffic class of IPv6 echo requests is reported
+func TestListenTrafficClass(t *testing.T) {
+	_, rts := loopbackSession(t, "::1", func(settings *Settings) {
+		settings.TOS = 0xb8
+	})
+
+	assert.Len(t, rts, 2)
+	for _, rt := range rts {
+		assert.Equal(t, 0xb8, rt.TOS)
+		assert.False(t, rt.TOSChanged)
+	}
+}
+
+// TestListenFlowLabel verifies that IPv6 echo requests are sent with the flow label, as seen by another raw socket
+func TestListenFlowLabel(t *testing.T) {
+	fd, err := unix.Socket(unix.AF_INET6, unix.SOCK_RAW|unix.SOCK_CLOEXEC, icmpv6Protocol)
+	if err != nil {
+		t.Skipf("could not create raw socket: %s", err)
+	}
+	// receives the flow info of every packet
+	assert.NoError(t, unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, ipv6FlowInfo, 1))
+	f := os.NewFile(uintptr(fd), "sniffer")
+	conn, err := net.FilePacketConn(f)
+	f.Close()
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	loopbackSession(t, "::1", func(settings *Settings) {
+		settings.FlowLabel = 0x12345
+		settings.MaxCount = 1
+	})
+
+	b := make([]byte, readBufferSize)
+	oob := make([]byte, recvControlSize)
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	for {
+		n, oobn, _, _, err := conn.(*net.IPConn).ReadMsgIP(b, oob)
+		if !assert.NoError(t, err, "the echo request must be seen") {
+			return
+		}
+
+		m, err := icmp.ParseMessage(icmpv6Protocol, b[:n])
+		if err != nil || m.Type != ipv6.ICMPTypeEchoRequest {
+			continue
+		}
+
+		msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		assert.NoError(t, err)
+		for _, msg := range msgs {
+			if msg.Header.Level == unix.IPPROTO_IPV6 && msg.Header.Type == ipv6FlowInfo {
+				assert.Equal(t, uint32(0x12345), binary.BigEndian.Uint32(msg.Data)&maxFlowLabel)
+				return
+			}
+		}
+		assert.Fail(t, "the echo request must have a flow info control message")
+		return
+	}
+}
+
+// TestFlowInfoMessage verifies that the flow info control message can be parsed back
+func TestFlowInfoMessage(t *testing.T) {
+	msgs, err := unix.ParseSocketControlMessage(flowInfoMessage(0xabcde))
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, int32(unix.IPPROTO_IPV6), msgs[0].Header.Level)
+	assert.Equal(t, int32(ipv6FlowInfo), msgs[0].Header.Type)
+	assert.Equal(t, []byte{0x00, 0x0a, 0xbc, 0xde}, msgs[0].Data[:4])
+}
+
+// TestParseControlMessage verifies that the TTL and TOS control messages are parsed
+func TestParseControlMessage(t *testing.T) {
+	ttl := make([]byte, 4)
+	*(*int32)(unsafe.Pointer(&ttl[0])) = 57
+
+	cm := &controlMessage{TOS: -1}
+	parseControlMessage(cm, unix.SocketControlMessage{
+		Header: unix.Cmsghdr{Level: unix.IPPROTO_IP, Type: unix.IP_TTL},
+		Data:   ttl,
+	})
+	parseControlMessage(cm, unix.SocketControlMessage{
+		Header: unix.Cmsghdr{Level: unix.IPPROTO_IP, Type: unix.IP_TOS},
+		Data:   []byte{0x28},
+	})
+	assert.Equal(t, 57, cm.TTL)
+	assert.Equal(t, 0x28, cm.TOS)
+
+	cm = &controlMessage{TOS: -1}
+	parseControlMessage(cm, unix.SocketControlMessage{
+		Header: unix.Cmsghdr{Level: unix.IPPROTO_IPV6, Type: unix.IPV6_HOPLIMIT},
+		Data:   ttl,
+	})
+	assert.Equal(t, 57, cm.TTL)
+	assert.Equal(t, -1, cm.TOS)
+
+	parseControlMessage(cm, unix.SocketControlMessage{
+		Header: unix.Cmsghdr{Level: unix.IPPROTO_IPV6, Type: unix.IPV6_TCLASS},
+		Data:   []byte{},
+	})
+	assert.Equal(t, -1, cm.TOS, "truncated messages must be ignored")
+}
+
+// TestParseControlMessageTimestamp tests if the kernel receive time is read from either timestamp message
+func TestParseControlMessageTimestamp(t *testing.T) {
+	now := time.Unix(1600000000, 123456789)
+	ts := unix.NsecToTimespec(now.UnixNano())
+	data := (*[unsafe.Sizeof(ts)]byte)(unsafe.Pointer(&ts))[:]
+
+	cm := &controlMessage{TOS: -1}
+	parseControlMessage(cm, unix.SocketControlMessage{
+		Header: unix.Cmsghdr{Level: unix.SOL_SOCKET, Type: unix.SCM_TIMESTAMPNS},
+		Data:   data,
+	})
+	assert.True(t, now.Equal(cm.Timestamp))
+
+	// the software timestamp is the first of the three
+	cm = &controlMessage{TOS: -1}
+	parseControlMessage(cm, unix.SocketControlMessage{
+		Header: unix.Cmsghdr{Level: unix.SOL_SOCKET, Type: unix.SCM_TIMESTAMPING},
+		Data:   append(append(append([]byte{}, data...), make([]byte, len(data))...), make([]byte, len(data))...),
+	})
+	assert.True(t, now.Equal(cm.Timestamp))
+
+	cm = &controlMessage{TOS: -1}
+	parseControlMessage(cm, unix.SocketControlMessage{
+		Header: unix.Cmsghdr{Level: unix.SOL_SOCKET, Type: unix.SCM_TIMESTAMPNS},
+		Data:   data[:4],
+	})
+	assert.True(t, cm.Timestamp.IsZero(), "truncated messages must be ignored")
+}
+
+// TestListenTimestamps verifies that the kernel stamps the echo requests and their replies on both IP versions, in
+// both privileged and non-privileged modes
+func TestListenTimestamps(t *testing.T) {
+	for _, privileged := range []bool{true, false} {
+		for _, addr := range []string{"127.0.0.1", "::1"} {
+			_, rts := loopbackSession(t, addr, func(settings *Settings) {
+				settings.IsPrivileged = privileged
+				if !privileged {
+					settings.Interval = 250 * time.Millisecond
+				}
+			})
+
+			assert.Len(t, rts, 2, "privileged %t to %s", privileged, addr)
+			for _, rt := range rts {
+				assert.Equal(t, ClockKernel, rt.Clock, "privileged %t to %s", privileged, addr)
+				assert.Equal(t, rt.Recv.Sub(rt.Sent), rt.Time)
+				assert.Greater(t, int64(rt.Time), int64(0))
+				assert.Less(t, int64(rt.Time), int64(time.Second))
+			}
+		}
+	}
+}
+
+// TestListenPMTUDisc verifies that every path MTU discovery policy can be set on both IP versions
+func TestListenPMTUDisc(t *testing.T) {
+	for _, policy := range []PMTUDisc{PMTUDiscDo, PMTUDiscWant, PMTUDiscDont, PMTUDiscProbe} {
+		for _, addr := range []string{"127.0.0.1", "::1"} {
+			s, _ := loopbackSession(t, addr, func(settings *Settings) {
+				settings.PMTUDisc = policy
+			})
+			assert.Equal(t, uint32(2), s.Stats.GetTotalRecv(), "%s to %s", policy, addr)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+//go:build !linux
+// +build !linux
+
+package core
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/net/icmp"
+)
+
+const (
+	// flowLabelSupported is whether the flow label of IPv6 packets can be set.
+	flowLabelSupported = false
+
+	// pmtuDiscSupported is whether the path MTU discovery policy can be set.
+	pmtuDiscSupported = false
+
+	// markSupported is whether the firewall mark of the socket can be set.
+	markSupported = false
+
+	// vrfSupported is whether the socket can be bound to a VRF device.
+	vrfSupported = false
+)
+
+// listenPacket listens to ICMP packets according to the binding of the session.
+func (s *Session) listenPacket() (*icmpConn, error) {
+	if s.bind.device != "" {
+		s.logger.Infof("Binding to interface %s", s.bind.device)
+		return s.listenDevice()
+	}
+
+	if s.bind.source != nil {
+		s.logger.Infof("Binding to source address %s", s.bind.source)
+	}
+	conn, err := icmp.ListenPacket(s.getNetwork(), s.bind.listenAddress())
+	if err != nil {
+		return nil, err
+	}
+
+	return newICMPConn(conn, s.isIPv4), nil
+}
+
+// listenDevice listens to ICMP packets on the first address of the network interface of the session binding with
+// the IP version of the session, as binding to an interface is only available on Linux.
+func (s *Session) listenDevice() (*icmpConn, error) {
+	iface, err := net.InterfaceByName(s.bind.device)
+	if err != nil {
+		return nil, fmt.Errorf("could not find interface %s: %w", s.bind.device, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("could not list the addresses of interface %s: %w", s.bind.device, err)
+	}
+
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || isIPv4(ipnet.IP) != s.isIPv4 {
+			continue
+		}
+
+		source := &net.IPAddr{IP: ipnet.IP}
+		if ipnet.IP.IsLinkLocalUnicast() && !s.isIPv4 {
+			source.Zone = s.bind.device
+		}
+
+		conn, err := icmp.ListenPacket(s.getNetwork(), source.String())
+		if err != nil {
+			return nil, err
+		}
+
+		return newICMPConn(conn, s.isIPv4), nil
+	}
+
+	return nil, fmt.Errorf("interface %s has no address of the same IP version as %s", s.bind.device, s.addr)
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// netnsSupported is whether the socket can be created in another network namespace.
+	netnsSupported = true
+
+	// netnsDir is the directory of the named network namespaces, as created by ip netns add.
+	netnsDir = "/var/run/netns"
+)
+
+// netnsPath returns the path of the network namespace with the given name, or the name itself if it is a path such
+// as /proc/PID/ns/net.
+func netnsPath(name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+
+	return filepath.Join(netnsDir, name)
+}
+
+// inNetns calls f with the calling goroutine in the network namespace of the session, if any. The goroutine is locked
+// to its thread while in the namespace, so that nothing else runs there, and the thread goes back to its original
+// namespace afterwards. Sockets created by f belong to the namespace for their whole life.
+func (s *Session) inNetns(f func() error) error {
+	if s.settings.Netns == "" {
+		return f()
+	}
+
+	runtime.LockOSThread()
+
+	origin, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("could not open the current network namespace: %w", err)
+	}
+	defer origin.Close()
+
+	target, err := os.Open(netnsPath(s.settings.Netns))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("could not open network namespace %s: %w", s.settings.Netns, err)
+	}
+	defer target.Close()
+
+	if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("could not enter network namespace %s: %w", s.settings.Netns, err)
+	}
+	s.logger.Debugf("Entered network namespace %s", s.settings.Netns)
+
+	ferr := f()
+
+	if err := unix.Setns(int(origin.Fd()), unix.CLONE_NEWNET); err != nil {
+		// the thread stays locked so that it is discarded with the goroutine instead of running others in the namespace
+		return fmt.Errorf("could not leave network namespace %s: %w", s.settings.Netns, err)
+	}
+	runtime.UnlockOSThread()
+
+	return ferr
+}
@@ -0,0 +1,235 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+// inNewNetns runs f in a goroutine whose thread is moved to a new network namespace with the loopback interface up,
+// skipping the test if the namespace can not be created. The thread is never unlocked, so it is discarded once f
+// returns instead of being reused by other goroutines. Sockets created by f belong to the namespace.
+func inNewNetns(t *testing.T, f func()) {
+	if _, err := exec.LookPath("ip"); err != nil {
+		t.Skip("ip command not found")
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+			errs <- err
+			return
+		}
+		if err := exec.Command("ip", "link", "set", "lo", "up").Run(); err != nil {
+			errs <- err
+			return
+		}
+
+		f()
+		errs <- nil
+	}()
+
+	if err := <-errs; err != nil {
+		t.Skipf("could not create network namespace: %s", err)
+	}
+}
+
+// ipCommand runs the ip command with args in the network namespace of the calling thread, returning whether it
+// succeeded
+func ipCommand(t *testing.T, args ...string) bool {
+	out, err := exec.Command("ip", args...).CombinedOutput()
+	if err != nil {
+		t.Logf("ip %v: %s: %s", args, err, out)
+		return false
+	}
+
+	return true
+}
+
+// unreachableSession runs a privileged session of a single echo request to 192.0.2.1, which is never replied, with
+// the settings changed by configure
+func unreachableSession(t *testing.T, configure func(*Settings)) *Session {
+	settings := DefaultSettings()
+	settings.IsPrivileged = true
+	settings.MaxCount = 1
+	settings.IsMaxCountDefault = false
+	settings.Interval = 10 * time.Millisecond
+	settings.Timeout = 50 * time.Millisecond
+	settings.TimeoutPolicy = TimeoutFixed
+	configure(settings)
+
+	s, err := NewSession("192.0.2.1", settings)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Run())
+
+	return s
+}
+
+// TestNetnsMark verifies that marked echo requests are routed by the table a policy routing rule selects for the mark,
+// while unmarked ones have no route
+func TestNetnsMark(t *testing.T) {
+	inNewNetns(t, func() {
+		if !ipCommand(t, "rule", "add", "fwmark", "7", "table", "100") ||
+			!ipCommand(t, "route", "add", "192.0.2.0/24", "dev", "lo", "table", "100") {
+			t.Error("could not set up policy routing")
+			return
+		}
+
+		marked := unreachableSession(t, func(settings *Settings) {
+			settings.Mark = 7
+		})
+		assert.Zero(t, marked.Stats.GetTotalErrors(), "marked echo requests must be routed by table 100")
+		assert.Equal(t, uint32(1), marked.Stats.GetTotalTimedOut())
+
+		unmarked := unreachableSession(t, func(settings *Settings) {})
+		assert.Equal(t, uint32(1), unmarked.Stats.GetTotalErrors(), "unmarked echo requests must have no route")
+	})
+}
+
+// TestNetnsVRF verifies that echo requests bound to a VRF are routed by its table, skipping the test if VRF devices
+// are not available
+func TestNetnsVRF(t *testing.T) {
+	available := true
+	inNewNetns(t, func() {
+		if !ipCommand(t, "link", "add", "vrf-test", "type", "vrf", "table", "10") {
+			available = false
+			return
+		}
+		if !ipCommand(t, "link", "set", "vrf-test", "up") ||
+			!ipCommand(t, "route", "add", "192.0.2.0/24", "dev", "vrf-test", "table", "10") {
+			t.Error("could not set up VRF")
+			return
+		}
+
+		bound := unreachableSession(t, func(settings *Settings) {
+			settings.VRF = "vrf-test"
+		})
+		assert.Zero(t, bound.Stats.GetTotalErrors(), "echo requests bound to the VRF must be routed by its table")
+
+		unbound := unreachableSession(t, func(settings *Settings) {})
+		assert.Equal(t, uint32(1), unbound.Stats.GetTotalErrors(), "unbound echo requests must have no route")
+	})
+
+	if !available {
+		t.Skip("VRF devices are not available")
+	}
+}
+
+// namedNetns creates a network namespace with ip netns, with the loopback interface up and 192.0.2.1 assigned to it,
+// returning its name and skipping the test if it can not be created. The namespace is deleted when the test ends.
+func namedNetns(t *testing.T) string {
+	if _, err := exec.LookPath("ip"); err != nil {
+		t.Skip("ip command not found")
+	}
+
+	name := fmt.Sprintf("pingo-test-%d", os.Getpid())
+	if !ipCommand(t, "netns", "add", name) {
+		t.Skip("could not create network namespace")
+	}
+	t.Cleanup(func() {
+		ipCommand(t, "netns", "del", name)
+	})
+
+	if !ipCommand(t, "-n", name, "link", "set", "lo", "up") ||
+		!ipCommand(t, "-n", name, "addr", "add", "192.0.2.1/32", "dev", "lo") {
+		t.Fatal("could not set up network namespace")
+	}
+
+	return name
+}
+
+// TestNetnsPath tests if names are looked up in /var/run/netns while paths are kept
+func TestNetnsPath(t *testing.T) {
+	assert.Equal(t, "/var/run/netns/blue", netnsPath("blue"))
+	assert.Equal(t, "/proc/1/ns/net", netnsPath("/proc/1/ns/net"))
+}
+
+// threadNetns returns the identity of the network namespace of the calling thread
+func threadNetns(t *testing.T) string {
+	ns, err := os.Readlink(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+	assert.NoError(t, err)
+
+	return ns
+}
+
+// TestNetnsNamed verifies that echo requests sent from a named network namespace, given by name or path, reach an
+// address assigned there
+func TestNetnsNamed(t *testing.T) {
+	name := namedNetns(t)
+
+	for _, netns := range []string{name, netnsPath(name)} {
+		s := unreachableSession(t, func(settings *Settings) {
+			settings.Netns = netns
+		})
+		assert.Equal(t, uint32(1), s.Stats.GetTotalRecv(), "echo requests must be replied in %s", netns)
+	}
+}
+
+// TestNetnsRestore verifies that the thread goes back to its network namespace once the socket is created
+func TestNetnsRestore(t *testing.T) {
+	name := namedNetns(t)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	settings := DefaultSettings()
+	settings.Netns = name
+	s, err := NewSession("192.0.2.1", settings)
+	assert.NoError(t, err)
+
+	origin := threadNetns(t)
+	var inside string
+	assert.NoError(t, s.inNetns(func() error {
+		inside = threadNetns(t)
+		return nil
+	}))
+	assert.NotEqual(t, origin, inside)
+	assert.Equal(t, origin, threadNetns(t))
+
+	assert.Equal(t, errors.New("failed"), s.inNetns(func() error {
+		return errors.New("failed")
+	}))
+	assert.Equal(t, origin, threadNetns(t))
+}
+
+// TestNetnsInterface verifies that interfaces are looked up in the network namespace of the session
+func TestNetnsInterface(t *testing.T) {
+	name := namedNetns(t)
+	if !ipCommand(t, "-n", name, "link", "add", "pingo-vt0", "type", "veth", "peer", "name", "pingo-vt1") {
+		t.Skip("veth devices are not available")
+	}
+
+	settings := DefaultSettings()
+	settings.Interface = "pingo-vt0"
+	settings.Netns = name
+	s, err := NewSession("192.0.2.1", settings)
+	assert.NoError(t, err)
+	assert.NoError(t, s.inNetns(func() error {
+		_, err := s.resolveBinding(&net.IPAddr{IP: net.ParseIP("192.0.2.1")})
+		return err
+	}))
+
+	settings.Netns = ""
+	s, err = NewSession("192.0.2.1", settings)
+	assert.NoError(t, err)
+	_, err = s.resolveBinding(&net.IPAddr{IP: net.ParseIP("192.0.2.1")})
+	assert.Error(t, err)
+}
+
+// TestNetnsMissing tests if a network namespace that does not exist is reported
+func TestNetnsMissing(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Netns = "pingo-missing"
+	s, err := NewSession("127.0.0.1", settings)
+	assert.NoError(t, err)
+	assert.Error(t, s.Run())
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package core
+
+// netnsSupported is whether the socket can be created in another network namespace.
+const netnsSupported = false
+
+// inNetns calls f, network namespaces are only available on Linux.
+func (s *Session) inNetns(f func() error) error {
+	return f()
+}
@@ -0,0 +1,158 @@
+package core
+
+import "golang.org/x/net/icmp"
+
+// Observer is notified of the lifecycle events of the sessions it is registered to.
+// Its methods are called from the session goroutines, in the order the observers were added.
+type Observer interface {
+	// OnStart is called when the session starts, with a sample of the echo requests it sends.
+	OnStart(s *Session, msg *icmp.Message)
+
+	// OnSend is called after an echo request is sent, with its extended seq and the marshalled message.
+	OnSend(s *Session, seq uint64, msg []byte)
+
+	// OnSendError is called when an echo request could not be sent.
+	OnSendError(s *Session, seq uint64, err error)
+
+	// OnRoundTrip is called when an echo request is replied, expires or times out.
+	OnRoundTrip(s *Session, rt *RoundTrip)
+
+	// OnUnmatched is called when a received packet does not match any outstanding echo request, such as replies
+	// meant for other sessions, late or duplicate replies and packets that could not be parsed.
+	// The packet is only valid during the call.
+	OnUnmatched(s *Session, packet []byte)
+
+	// OnICMPError is called when an ICMP error message regarding an echo request of the session is received, other
+	// than time exceeded messages, which are round trips. The seq is the 16-bit seq quoted by the message.
+	OnICMPError(s *Session, seq int, msg *icmp.Message)
+
+	// OnFinish is called when the session ends.
+	OnFinish(s *Session)
+
+	// OnPause is called when the session stops sending echo requests after Pause.
+	OnPause(s *Session)
+
+	// OnResume is called when the session sends echo requests again after Resume.
+	OnResume(s *Session)
+}
+
+// BaseObserver implements every Observer method doing nothing, it is meant to be embedded by observers that only
+// care about a few events.
+type BaseObserver struct{}
+
+// OnStart does nothing.
+func (BaseObserver) OnStart(s *Session, msg *icmp.Message) {}
+
+// OnSend does nothing.
+func (BaseObserver) OnSend(s *Session, seq uint64, msg []byte) {}
+
+// OnSendError does nothing.
+func (BaseObserver) OnSendError(s *Session, seq uint64, err error) {}
+
+// OnRoundTrip does nothing.
+func (BaseObserver) OnRoundTrip(s *Session, rt *RoundTrip) {}
+
+// OnUnmatched does nothing.
+func (BaseObserver) OnUnmatched(s *Session, packet []byte) {}
+
+// OnICMPError does nothing.
+func (BaseObserver) OnICMPError(s *Session, seq int, msg *icmp.Message) {}
+
+// OnFinish does nothing.
+func (BaseObserver) OnFinish(s *Session) {}
+
+// OnPause does nothing.
+func (BaseObserver) OnPause(s *Session) {}
+
+// OnResume does nothing.
+func (BaseObserver) OnResume(s *Session) {}
+
+// funcObserver is an observer made of a single callback function, used by the AddOn methods.
+type funcObserver struct {
+	BaseObserver
+	onStart  func(*Session, *icmp.Message)
+	onSend   func(*Session, uint64, []byte)
+	onRecv   func(*Session, *RoundTrip)
+	onFinish func(*Session)
+}
+
+func (o *funcObserver) OnStart(s *Session, msg *icmp.Message) {
+	if o.onStart != nil {
+		o.onStart(s, msg)
+	}
+}
+
+func (o *funcObserver) OnSend(s *Session, seq uint64, msg []byte) {
+	if o.onSend != nil {
+		o.onSend(s, seq, msg)
+	}
+}
+
+func (o *funcObserver) OnRoundTrip(s *Session, rt *RoundTrip) {
+	if o.onRecv != nil {
+		o.onRecv(s, rt)
+	}
+}
+
+func (o *funcObserver) OnFinish(s *Session) {
+	if o.onFinish != nil {
+		o.onFinish(s)
+	}
+}
+
+// AddObserver registers o to be notified of the events of the session, it is safe to call it at any moment.
+func (s *Session) AddObserver(o Observer) {
+	s.observersMutex.Lock()
+	defer s.observersMutex.Unlock()
+
+	s.observers = append(s.observers, o)
+}
+
+// RemoveObserver unregisters o, which then stops being notified, it is safe to call it at any moment.
+// Observers are compared with ==, so o must be comparable, e.g. a pointer.
+func (s *Session) RemoveObserver(o Observer) {
+	s.observersMutex.Lock()
+	defer s.observersMutex.Unlock()
+
+	for i, val := range s.observers {
+		if val == o {
+			// copying so that notifications in progress keep iterating over the previous slice
+			observers := make([]Observer, 0, len(s.observers)-1)
+			observers = append(observers, s.observers[:i]...)
+			s.observers = append(observers, s.observers[i+1:]...)
+			return
+		}
+	}
+}
+
+// AddOnStart adds a handler function that will be called when the session starts
+func (s *Session) AddOnStart(handler func(*Session, *icmp.Message)) {
+	s.AddObserver(&funcObserver{onStart: handler})
+}
+
+// AddOnSend adds a handler function that will be called after an echo request is sent, with its extended seq and
+// the marshalled message
+func (s *Session) AddOnSend(handler func(*Session, uint64, []byte)) {
+	s.AddObserver(&funcObserver{onSend: handler})
+}
+
+// AddOnRecv adds a handler function that will be called after an echo request is replied or expires
+func (s *Session) AddOnRecv(handler func(*Session, *RoundTrip)) {
+	s.AddObserver(&funcObserver{onRecv: handler})
+}
+
+// AddOnFinish adds a handler function that will be called when the session ends
+func (s *Session) AddOnFinish(handler func(*Session)) {
+	s.AddObserver(&funcObserver{onFinish: handler})
+}
+
+// notify calls f with every registered observer, in the order they were added.
+func (s *Session) notify(f func(Observer)) {
+	s.observersMutex.Lock()
+	observers := s.observers
+	s.observersMutex.Unlock()
+
+	for _, o := range observers {
+		f(o)
+	}
+}
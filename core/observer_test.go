@@ -0,0 +1,155 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// recorder is an observer that records the name of every method called
+type recorder struct {
+	BaseObserver
+	mutex   sync.Mutex
+	calls   []string
+	sent    map[uint64][]byte
+	icmpSeq int
+}
+
+func newRecorder() *recorder {
+	return &recorder{sent: make(map[uint64][]byte)}
+}
+
+func (r *recorder) record(call string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) OnStart(s *Session, msg *icmp.Message) { r.record("start") }
+func (r *recorder) OnSend(s *Session, seq uint64, msg []byte) {
+	r.mutex.Lock()
+	r.sent[seq] = msg
+	r.mutex.Unlock()
+	r.record("send")
+}
+func (r *recorder) OnSendError(s *Session, seq uint64, err error) { r.record("senderror") }
+func (r *recorder) OnRoundTrip(s *Session, rt *RoundTrip)         { r.record("roundtrip") }
+func (r *recorder) OnUnmatched(s *Session, packet []byte)         { r.record("unmatched") }
+func (r *recorder) OnICMPError(s *Session, seq int, msg *icmp.Message) {
+	r.icmpSeq = seq
+	r.record("icmperror")
+}
+func (r *recorder) OnFinish(s *Session) { r.record("finish") }
+func (r *recorder) OnPause(s *Session)  { r.record("pause") }
+func (r *recorder) OnResume(s *Session) { r.record("resume") }
+
+// TestSessionObserver verifies that an observer is notified of every event of a run
+func TestSessionObserver(t *testing.T) {
+	s, _ := fakeSession(t, 2)
+	r := newRecorder()
+	s.AddObserver(r)
+
+	assert.NoError(t, s.Run())
+	assert.Equal(t, "start", r.calls[0])
+	assert.Equal(t, "finish", r.calls[len(r.calls)-1])
+	assert.Len(t, r.calls, 6)
+
+	// the marshalled message of each echo request is given with its extended seq
+	for seq, msg := range r.sent {
+		m, err := icmp.ParseMessage(icmpProtocol, msg)
+		assert.NoError(t, err)
+		assert.Equal(t, int(seq), m.Body.(*icmp.Echo).Seq)
+	}
+	assert.Len(t, r.sent, 2)
+}
+
+// TestSessionObserverSendError verifies that observers are notified of echo requests that could not be sent
+func TestSessionObserverSendError(t *testing.T) {
+	s, conn := fakeSession(t, 2)
+	conn.writeErr = fmt.Errorf("network is unreachable")
+	r := newRecorder()
+	s.AddObserver(r)
+
+	assert.NoError(t, s.Run())
+	assert.Equal(t, []string{"start", "senderror", "senderror", "finish"}, r.calls)
+	assert.Equal(t, uint32(2), s.Stats.GetTotalErrors())
+}
+
+// TestSessionRemoveObserver verifies that a removed observer is no longer notified
+func TestSessionRemoveObserver(t *testing.T) {
+	s, _ := fakeSession(t, 1)
+	r := newRecorder()
+	other := newRecorder()
+	s.AddObserver(r)
+	s.AddObserver(other)
+	s.RemoveObserver(r)
+	s.RemoveObserver(newRecorder())
+
+	assert.NoError(t, s.Run())
+	assert.Empty(t, r.calls)
+	assert.NotEmpty(t, other.calls)
+}
+
+// TestSessionObserverUnmatched verifies that observers are notified of packets that match no outstanding request
+func TestSessionObserverUnmatched(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+	r := newRecorder()
+	s.AddObserver(r)
+
+	late, err := buildEchoReply(s.id, 1, s.bigID, s.isIPv4)
+	assert.NoError(t, err)
+	s.handleRawPacket(late)
+
+	other, err := buildEchoReply(s.id, 1, s.bigID+1, s.isIPv4)
+	assert.NoError(t, err)
+	s.handleRawPacket(other)
+
+	assert.Equal(t, []string{"unmatched", "unmatched"}, r.calls)
+}
+
+// TestSessionObserverICMPError verifies that observers are notified of ICMP error messages quoting a session request
+func TestSessionObserverICMPError(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+	s.isIPv4 = true
+	r := newRecorder()
+	s.AddObserver(r)
+
+	pkt, err := buildDestinationUnreachable(uint16(s.id), 7)
+	assert.NoError(t, err)
+	s.handleRawPacket(pkt)
+
+	pkt, err = buildDestinationUnreachable(uint16(s.id+1), 7)
+	assert.NoError(t, err)
+	s.handleRawPacket(pkt)
+
+	assert.Equal(t, []string{"icmperror", "unmatched"}, r.calls)
+	assert.Equal(t, 7, r.icmpSeq)
+}
+
+// buildDestinationUnreachable builds an IPv4 destination unreachable message quoting an echo request with id and seq
+func buildDestinationUnreachable(id uint16, seq uint16) (*rawPacket, error) {
+	quoted := append(make([]byte, 24), append(uint16ToBytes(id), uint16ToBytes(seq)...)...)
+	msg := &icmp.Message{
+		Type: ipv4.ICMPTypeDestinationUnreachable,
+		Code: 1,
+		Body: &icmp.DstUnreach{Data: quoted},
+	}
+
+	bytes, err := msg.Marshal(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rawPacket{
+		content: bytes,
+		length:  len(bytes),
+		cm:      &controlMessage{TTL: 64, Src: net.IPv4(10, 0, 0, 1)},
+	}, nil
+}
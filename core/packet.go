@@ -2,6 +2,7 @@ package core
 
 import (
 	"net"
+	"time"
 )
 
 // Raw packet read from the connection and used to pass information to the session.
@@ -9,11 +10,28 @@ type rawPacket struct {
 	content []byte
 	length  int
 	cm      *controlMessage
+
+	// readAt is the time the packet was read from the connection, zero if unknown
+	readAt instant
+
+	// buffer is the pooled buffer backing content, nil if it did not come from bufferPool
+	buffer *[]byte
+}
+
+// release gives the buffer backing the packet back to the pool, the packet must not be used afterwards.
+func (p *rawPacket) release() {
+	if p.buffer != nil {
+		bufferPool.Put(p.buffer)
+		p.buffer = nil
+	}
 }
 
 // controlMessage contains relevant info from the incoming ICMP message
 type controlMessage struct {
 	TTL int    // time-to-live, receiving only
+	TOS int    // type of service, or traffic class for IPv6, receiving only, -1 if unknown
 	Src net.IP // source address, specifying only
 	Dst net.IP // destination address, receiving only
+
+	Timestamp time.Time // time the kernel received the packet, receiving only, zero if unknown
 }
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// PMTUDisc is the path MTU discovery policy of the echo requests, which decides whether they may be fragmented.
+type PMTUDisc int
+
+const (
+	// PMTUDiscDefault keeps the policy of the system.
+	PMTUDiscDefault PMTUDisc = iota
+	// PMTUDiscDo sets the Don't Fragment flag and never fragments locally, echo requests larger than the path MTU are
+	// not sent.
+	PMTUDiscDo
+	// PMTUDiscWant fragments echo requests larger than the path MTU, setting the Don't Fragment flag otherwise.
+	PMTUDiscWant
+	// PMTUDiscDont never sets the Don't Fragment flag.
+	PMTUDiscDont
+	// PMTUDiscProbe sets the Don't Fragment flag but ignores the path MTU, only echo requests larger than the MTU of
+	// the interface are not sent.
+	PMTUDiscProbe
+)
+
+// pmtuDiscs are all valid path MTU discovery policies, indexed by their value.
+var pmtuDiscs = []string{"default", "do", "want", "dont", "probe"}
+
+// String returns the name of the path MTU discovery policy.
+func (p PMTUDisc) String() string {
+	if p < 0 || int(p) >= len(pmtuDiscs) {
+		return fmt.Sprintf("PMTUDisc(%d)", int(p))
+	}
+
+	return pmtuDiscs[p]
+}
+
+// ParsePMTUDisc returns the path MTU discovery policy with the given name.
+func ParsePMTUDisc(name string) (PMTUDisc, error) {
+	for i, val := range pmtuDiscs {
+		if val == name {
+			return PMTUDisc(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid path MTU discovery policy %q, must be one of %s", name, strings.Join(pmtuDiscs, ", "))
+}
+
+// isMessageTooLong returns whether err means that a packet was not sent because it is larger than the MTU and may not
+// be fragmented.
+func isMessageTooLong(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE)
+}
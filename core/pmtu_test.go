@@ -0,0 +1,56 @@
+package core
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParsePMTUDisc verifies that every policy can be parsed back from its name
+func TestParsePMTUDisc(t *testing.T) {
+	for _, policy := range []PMTUDisc{PMTUDiscDefault, PMTUDiscDo, PMTUDiscWant, PMTUDiscDont, PMTUDiscProbe} {
+		parsed, err := ParsePMTUDisc(policy.String())
+		assert.NoError(t, err)
+		assert.Equal(t, policy, parsed)
+	}
+
+	_, err := ParsePMTUDisc("maybe")
+	assert.Error(t, err)
+	assert.Equal(t, "PMTUDisc(42)", PMTUDisc(42).String())
+}
+
+// TestIsMessageTooLong verifies that wrapped EMSGSIZE errors are recognized
+func TestIsMessageTooLong(t *testing.T) {
+	err := &net.OpError{Op: "write", Net: "ip4:icmp", Err: os.NewSyscallError("sendto", syscall.EMSGSIZE)}
+	assert.True(t, isMessageTooLong(err))
+	assert.False(t, isMessageTooLong(os.NewSyscallError("sendto", syscall.EPERM)))
+	assert.False(t, isMessageTooLong(nil))
+}
+
+// TestSessionMessageTooLong verifies that echo requests too long to be sent are round trips of their own and not
+// errors
+func TestSessionMessageTooLong(t *testing.T) {
+	s, conn := fakeSession(t, 2)
+	conn.writeErr = &net.OpError{Op: "write", Net: "ip4:icmp", Err: os.NewSyscallError("sendto", syscall.EMSGSIZE)}
+
+	var rts []*RoundTrip
+	s.AddOnRecv(func(_ *Session, rt *RoundTrip) {
+		rts = append(rts, rt)
+	})
+
+	assert.NoError(t, s.Run())
+
+	assert.Equal(t, uint32(2), s.Stats.GetTotalSent())
+	assert.Equal(t, uint32(2), s.Stats.GetTotalTooLong())
+	assert.Zero(t, s.Stats.GetTotalErrors())
+	assert.Zero(t, s.Stats.GetTotalPending())
+	assert.Len(t, rts, 2)
+	for i, rt := range rts {
+		assert.Equal(t, MessageTooLong, rt.Res)
+		assert.Equal(t, uint64(i+1), rt.ExtSeq)
+		assert.True(t, rt.Len > s.settings.PayloadSize)
+	}
+}
@@ -3,26 +3,26 @@ package core
 import "sync"
 
 // ReplyMap is the interface for a thread-safe map that will store channels
-// used by echo requests to receive their replies
+// used by echo requests to receive their replies, keyed by their extended seq
 type ReplyMap interface {
-	GetOrCreate(key uint16) chan *RoundTrip
-	Get(key uint16) (chan *RoundTrip, bool)
-	Erase(key uint16)
+	GetOrCreate(key uint64) chan *RoundTrip
+	Get(key uint64) (chan *RoundTrip, bool)
+	Erase(key uint64)
 }
 
 type replyMap struct {
-	allData map[uint16](chan *RoundTrip)
+	allData map[uint64](chan *RoundTrip)
 	rwm     sync.RWMutex
 }
 
 func newReplyMap() ReplyMap {
 	return &replyMap{
-		allData: make(map[uint16](chan *RoundTrip)),
+		allData: make(map[uint64](chan *RoundTrip)),
 		rwm:     sync.RWMutex{},
 	}
 }
 
-func (m *replyMap) GetOrCreate(key uint16) chan *RoundTrip {
+func (m *replyMap) GetOrCreate(key uint64) chan *RoundTrip {
 	m.rwm.Lock()
 	defer m.rwm.Unlock()
 	ch, ok := m.allData[key]
@@ -33,19 +33,16 @@ func (m *replyMap) GetOrCreate(key uint16) chan *RoundTrip {
 	return ch
 }
 
-func (m *replyMap) Get(key uint16) (chan *RoundTrip, bool) {
+func (m *replyMap) Get(key uint64) (chan *RoundTrip, bool) {
 	m.rwm.Lock()
 	defer m.rwm.Unlock()
 	ch, ok := m.allData[key]
 	return ch, ok
 }
 
-func (m *replyMap) Erase(key uint16) {
+func (m *replyMap) Erase(key uint64) {
 	m.rwm.Lock()
 	defer m.rwm.Unlock()
-	ch, ok := m.allData[key]
-	if ok {
-		close(ch)
-		delete(m.allData, key)
-	}
+	// the channel is not closed as a reply may still be being delivered to it
+	delete(m.allData, key)
 }
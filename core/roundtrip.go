@@ -15,26 +15,70 @@ const (
 	TTLExpired
 	// TimedOut is the result of when an echo request does not receive a reply in an expected time
 	TimedOut
+	// MessageTooLong is the result of when an echo request is not sent because it is larger than the MTU and may not
+	// be fragmented, according to the path MTU discovery policy
+	MessageTooLong
 )
 
 // RoundTrip represents an echo request and its counterpart reply (or absence of it)
 type RoundTrip struct {
-	TTL  int             // time-to-live, receiving only
-	Seq  int             // seq of reply, successful or not
-	Len  int             // len of reply
-	Src  net.IP          // src address
-	Time time.Duration   // rtt, successful-only
-	Res  RoundTripResult // result
+	TTL        int             // time-to-live, receiving only
+	TOS        int             // type of service, or traffic class for IPv6, receiving only, -1 if unknown
+	TOSChanged bool            // whether the DSCP of the reply differs from the one of the request, successful-only
+	Seq        int             // seq of reply, successful or not
+	ExtSeq     uint64          // extended seq of the request, unlike seq it does not wrap around at 65535
+	Len        int             // len of reply
+	Src        net.IP          // src address
+	Time       time.Duration   // rtt, successful-only
+	Res        RoundTripResult // result
+	Sent       time.Time       // time the echo request was sent
+	Recv       time.Time       // time the reply was received, zero if there was none
+	Clock      ClockSource     // where the times the rtt is measured with come from, successful-only
+
+	PayloadSent   time.Time // time the request was sent according to the payload of the reply, successful-only
+	ClockDiverged bool      // whether the payload time diverges from the monotonic rtt, e.g. if the clock stepped
+
+	// readAt is the time the reply was read by the session, zero if there was none
+	readAt instant
+
+	// userTime is the rtt measured on the monotonic clock up to readAt, which unlike kernel timestamps includes the
+	// time the reply waited to be read, successful-only, zero if unknown
+	userTime time.Duration
+}
+
+// timeoutRTT returns the rtt the time to wait for the next replies is computed from. Timeouts are waited for by the
+// session, so they must account for the time replies wait to be read even when rt.Time leaves it out.
+func (rt *RoundTrip) timeoutRTT() time.Duration {
+	if rt.userTime > rt.Time {
+		return rt.userTime
+	}
+
+	return rt.Time
 }
 
 // buildTimedOutRT builds a round trip object containing data relevant to a timed out request.
-func buildTimedOutRT(seq int, time time.Duration) *RoundTrip {
+func buildTimedOutRT(seq uint64, sent time.Time, timeout time.Duration) *RoundTrip {
+	return &RoundTrip{
+		TTL:    0,
+		TOS:    -1,
+		Time:   timeout,
+		Len:    0,
+		Seq:    int(uint16(seq)),
+		ExtSeq: seq,
+		Src:    nil,
+		Res:    TimedOut,
+		Sent:   sent,
+	}
+}
+
+// buildMessageTooLongRT builds a round trip object containing data relevant to a request too long to be sent.
+func buildMessageTooLongRT(seq uint64, sent time.Time, length int) *RoundTrip {
 	return &RoundTrip{
-		TTL:  0,
-		Time: time,
-		Len:  0,
-		Seq:  seq,
-		Src:  nil,
-		Res:  TimedOut,
+		TOS:    -1,
+		Len:    length,
+		Seq:    int(uint16(seq)),
+		ExtSeq: seq,
+		Res:    MessageTooLong,
+		Sent:   sent,
 	}
 }
@@ -14,14 +14,18 @@ func TestRTBuildTimedOut(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, s)
 
-	rt := buildTimedOutRT(s.lastSeq, s.getTimeoutDuration())
+	sent := time.Now()
+	rt := buildTimedOutRT(s.lastSeq, sent, s.getTimeoutDuration())
 
 	assert.Equal(t, TimedOut, rt.Res)
-	assert.Equal(t, s.lastSeq, rt.Seq)
+	assert.Equal(t, int(s.lastSeq), rt.Seq)
+	assert.Equal(t, s.lastSeq, rt.ExtSeq)
 	assert.Equal(t, s.getTimeoutDuration(), rt.Time)
 	assert.Equal(t, 0, rt.Len)
 	assert.Equal(t, 0, rt.TTL)
 	assert.Nil(t, rt.Src)
+	assert.Equal(t, sent, rt.Sent)
+	assert.True(t, rt.Recv.IsZero())
 }
 
 // buildRoundTrip returns a stub round trip with the desired result
@@ -0,0 +1,233 @@
+package core
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Schedule is the strategy used to space the echo requests of a session.
+type Schedule int
+
+const (
+	// ScheduleFixed sends echo requests at a fixed interval.
+	ScheduleFixed Schedule = iota
+	// ScheduleJitter sends echo requests at intervals uniformly distributed around the interval, within the jitter.
+	ScheduleJitter
+	// SchedulePoisson sends echo requests at exponentially distributed intervals whose mean is the interval, so that
+	// they form a Poisson process as recommended by RFC 2330 and RFC 7679.
+	SchedulePoisson
+)
+
+// schedules are all valid schedules, indexed by their value.
+var schedules = []string{"fixed", "jitter", "poisson"}
+
+// String returns the name of the schedule.
+func (sc Schedule) String() string {
+	if sc < 0 || int(sc) >= len(schedules) {
+		return fmt.Sprintf("Schedule(%d)", int(sc))
+	}
+
+	return schedules[sc]
+}
+
+// ParseSchedule returns the schedule with the given name.
+func ParseSchedule(name string) (Schedule, error) {
+	for i, val := range schedules {
+		if val == name {
+			return Schedule(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid schedule %q, must be one of %s", name, strings.Join(schedules, ", "))
+}
+
+// scheduler decides when the next echo request of a session is sent. It is only used by the goroutine running the
+// session loop.
+type scheduler interface {
+	// C returns the channel that fires when the next echo request must be sent, nil while none must be sent.
+	C() <-chan time.Time
+
+	// sent is called after an echo request is sent, or failed to be sent, at the given time.
+	sent(at time.Time)
+
+	// done is called after an echo request is replied, expires or times out, with the amount of echo requests still
+	// outstanding.
+	done(outstanding int)
+
+	// Stop stops the scheduler, whose channel does not fire anymore until an echo request is done.
+	Stop()
+}
+
+// newScheduler creates the scheduler of the session according to its settings, given the amount of echo requests
+// currently outstanding.
+func (s *Session) newScheduler(outstanding int) scheduler {
+	if s.settings.Adaptive {
+		s.logger.Debugf("Initializing adaptive scheduler with min interval %s", s.settings.minIntervalDuration())
+		return newAdaptiveScheduler(s.clock, s.settings.minIntervalDuration(), outstanding)
+	}
+
+	if s.settings.Schedule != ScheduleFixed {
+		s.logger.Debugf("Initializing %s scheduler with mean interval %s", s.settings.Schedule, s.getIntervalDuration())
+		return newRandomScheduler(s.clock, s.nextInterval)
+	}
+
+	s.logger.Debugf("Initializing interval ticker to duration %s", s.getIntervalDuration())
+	return &tickerScheduler{ticker: s.clock.NewTicker(s.getIntervalDuration())}
+}
+
+// newScheduleRand creates the random number generator of the schedule, seeded with seed unless it is zero.
+func newScheduleRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return rand.New(rand.NewSource(seed))
+}
+
+// nextInterval returns a random interval until the next echo request according to the schedule of the session,
+// never smaller than the minimal interval allowed.
+func (s *Session) nextInterval() time.Duration {
+	interval := float64(s.settings.Interval)
+	switch s.settings.Schedule {
+	case ScheduleJitter:
+		interval *= 1 + s.settings.Jitter*(2*s.scheduleRand.Float64()-1)
+	case SchedulePoisson:
+		interval *= s.scheduleRand.ExpFloat64()
+	}
+
+	d := time.Duration(interval)
+	if min := s.settings.minIntervalDuration(); d < min {
+		return min
+	}
+
+	return d
+}
+
+// tickerScheduler sends echo requests at a fixed interval, regardless of their replies.
+type tickerScheduler struct {
+	ticker Ticker
+}
+
+// C returns the channel of the ticker.
+func (t *tickerScheduler) C() <-chan time.Time {
+	return t.ticker.C()
+}
+
+// sent does nothing, the interval does not depend on the echo requests.
+func (t *tickerScheduler) sent(at time.Time) {}
+
+// done does nothing, the interval does not depend on the replies.
+func (t *tickerScheduler) done(outstanding int) {}
+
+// Stop stops the ticker.
+func (t *tickerScheduler) Stop() {
+	t.ticker.Stop()
+}
+
+// randomScheduler sends echo requests at random intervals given by next.
+type randomScheduler struct {
+	timer Timer
+	next  func() time.Duration
+}
+
+// newRandomScheduler creates a random scheduler that fires after the first interval given by next, waiting with clock.
+func newRandomScheduler(clock Clock, next func() time.Duration) *randomScheduler {
+	return &randomScheduler{
+		timer: clock.NewTimer(next()),
+		next:  next,
+	}
+}
+
+// C returns the channel of the timer.
+func (r *randomScheduler) C() <-chan time.Time {
+	return r.timer.C()
+}
+
+// sent waits for a new random interval.
+func (r *randomScheduler) sent(at time.Time) {
+	stopTimer(r.timer)
+	r.timer.Reset(r.next())
+}
+
+// done does nothing, the intervals do not depend on the replies.
+func (r *randomScheduler) done(outstanding int) {}
+
+// Stop stops the timer.
+func (r *randomScheduler) Stop() {
+	stopTimer(r.timer)
+}
+
+// adaptiveScheduler sends an echo request as soon as the previous one is done, so that at most one is outstanding
+// and the interval adapts to the round trip time, as ping -A does. Two echo requests are never sent less than min
+// apart.
+type adaptiveScheduler struct {
+	clock    Clock
+	min      time.Duration
+	timer    Timer
+	waiting  bool
+	lastSent time.Time
+}
+
+// newAdaptiveScheduler creates an adaptive scheduler that fires after min, or after the outstanding echo requests
+// are done if there are any, waiting with clock.
+func newAdaptiveScheduler(clock Clock, min time.Duration, outstanding int) *adaptiveScheduler {
+	a := &adaptiveScheduler{
+		clock:   clock,
+		min:     min,
+		timer:   clock.NewTimer(min),
+		waiting: outstanding > 0,
+	}
+	if a.waiting {
+		stopTimer(a.timer)
+	}
+
+	return a
+}
+
+// C returns the channel of the timer, nil while waiting for the outstanding echo request.
+func (a *adaptiveScheduler) C() <-chan time.Time {
+	if a.waiting {
+		return nil
+	}
+
+	return a.timer.C()
+}
+
+// sent waits for the echo request sent at the given time to be done.
+func (a *adaptiveScheduler) sent(at time.Time) {
+	stopTimer(a.timer)
+	a.waiting = true
+	a.lastSent = at
+}
+
+// done fires as soon as no echo request is outstanding, but not earlier than min after the last one was sent.
+func (a *adaptiveScheduler) done(outstanding int) {
+	if !a.waiting || outstanding > 0 {
+		return
+	}
+
+	a.waiting = false
+
+	wait := a.min - a.clock.Now().Sub(a.lastSent)
+	if wait < 0 {
+		wait = 0
+	}
+	a.timer.Reset(wait)
+}
+
+// Stop stops the timer.
+func (a *adaptiveScheduler) Stop() {
+	stopTimer(a.timer)
+}
+
+// stopTimer stops the timer and drains its channel so that it can be reset.
+func stopTimer(timer Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C():
+		default:
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// outstandingRecorder records the largest amount of outstanding echo requests right after each send
+type outstandingRecorder struct {
+	BaseObserver
+
+	mutex sync.Mutex
+	max   int
+	sent  []time.Time
+}
+
+func (o *outstandingRecorder) OnSend(s *Session, seq uint64, msg []byte) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if n := s.outstandingCount(); n > o.max {
+		o.max = n
+	}
+	o.sent = append(o.sent, time.Now())
+}
+
+// adaptiveSession creates a privileged adaptive session with count echo requests over a fake connection whose
+// replies take rtt
+func adaptiveSession(t *testing.T, count int, rtt time.Duration) (*Session, *fakeConn, *outstandingRecorder) {
+	s, conn := fakeSession(t, count)
+	s.settings.Adaptive = true
+	s.settings.Interval = time.Second
+	conn.delay = func(seq uint64) time.Duration { return rtt }
+
+	recorder := &outstandingRecorder{}
+	s.AddObserver(recorder)
+
+	return s, conn, recorder
+}
+
+// TestAdaptiveScheduler verifies that the adaptive scheduler only fires once nothing is outstanding and min has
+// passed since the last send
+func TestAdaptiveScheduler(t *testing.T) {
+	min := 50 * time.Millisecond
+	clock := newTestClock()
+
+	a := newAdaptiveScheduler(clock, min, 0)
+	clock.Advance(min - time.Millisecond)
+	_, ok := fired(a.C())
+	assert.False(t, ok)
+	clock.Advance(time.Millisecond)
+	_, ok = fired(a.C())
+	assert.True(t, ok)
+
+	a = newAdaptiveScheduler(clock, min, 1)
+	assert.Nil(t, a.C())
+	a.done(0)
+	_, ok = fired(a.C())
+	assert.True(t, ok, "the outstanding echo request was sent before the scheduler existed")
+
+	a.sent(clock.Now())
+	assert.Nil(t, a.C())
+
+	a.done(1)
+	assert.Nil(t, a.C(), "must wait for every outstanding echo request")
+
+	clock.Advance(20 * time.Millisecond)
+	a.done(0)
+	_, ok = fired(a.C())
+	assert.False(t, ok, "min has not passed since the last send")
+	clock.Advance(30 * time.Millisecond)
+	_, ok = fired(a.C())
+	assert.True(t, ok)
+
+	a.sent(clock.Now())
+	clock.Advance(min)
+	a.done(0)
+	_, ok = fired(a.C())
+	assert.True(t, ok, "min has already passed since the last send")
+
+	a.Stop()
+}
+
+// TestSessionAdaptive verifies that the interval follows the round trip time, keeping at most one echo request
+// outstanding
+func TestSessionAdaptive(t *testing.T) {
+	rtt := 30 * time.Millisecond
+	s, _, recorder := adaptiveSession(t, 5, rtt)
+
+	start := time.Now()
+	assert.NoError(t, s.Run())
+	elapsed := time.Since(start)
+
+	assert.Equal(t, uint32(5), s.Stats.GetTotalSent())
+	assert.Equal(t, uint32(5), s.Stats.GetTotalRecv())
+	assert.Equal(t, 1, recorder.max)
+	assert.True(t, elapsed >= 5*rtt, "sent faster than replies arrived: %s", elapsed)
+	assert.True(t, elapsed < time.Second, "the interval setting must be ignored: %s", elapsed)
+}
+
+// TestSessionAdaptiveMinInterval verifies that fast replies do not bring the interval below the minimal one
+func TestSessionAdaptiveMinInterval(t *testing.T) {
+	s, _, recorder := adaptiveSession(t, 6, 0)
+
+	assert.NoError(t, s.Run())
+
+	assert.Equal(t, uint32(6), s.Stats.GetTotalRecv())
+	assert.Len(t, recorder.sent, 6)
+	for i := 1; i < len(recorder.sent); i++ {
+		assert.True(t, recorder.sent[i].Sub(recorder.sent[i-1]) >= minInterval)
+	}
+}
+
+// TestSessionAdaptiveLoss verifies that a lost reply only delays the next echo request until it times out
+func TestSessionAdaptiveLoss(t *testing.T) {
+	s, conn, recorder := adaptiveSession(t, 4, 10*time.Millisecond)
+	s.settings.TimeoutPolicy = TimeoutIPutils
+	conn.drop = func(seq uint64) bool { return seq == 2 }
+
+	start := time.Now()
+	assert.NoError(t, s.Run())
+
+	assert.Equal(t, uint32(3), s.Stats.GetTotalRecv())
+	assert.Equal(t, uint32(1), s.Stats.GetTotalTimedOut())
+	assert.Equal(t, 1, recorder.max)
+	assert.True(t, time.Since(start) < time.Second, "the timeout after the first reply is two round trips")
+}
+
+// TestSessionAdaptiveSendError verifies that a failed send does not stall the adaptive schedule
+func TestSessionAdaptiveSendError(t *testing.T) {
+	s, conn, _ := adaptiveSession(t, 3, 0)
+	conn.writeErr = fmt.Errorf("network is unreachable")
+
+	assert.NoError(t, s.Run())
+	assert.Equal(t, uint32(3), s.Stats.GetTotalSent())
+	assert.Equal(t, uint32(3), s.Stats.GetTotalErrors())
+}
+
+// TestScheduleString verifies the names of the schedules and that they are parsed back
+func TestScheduleString(t *testing.T) {
+	for _, sc := range []Schedule{ScheduleFixed, ScheduleJitter, SchedulePoisson} {
+		parsed, err := ParseSchedule(sc.String())
+		assert.NoError(t, err)
+		assert.Equal(t, sc, parsed)
+	}
+
+	assert.Equal(t, "Schedule(42)", Schedule(42).String())
+
+	_, err := ParseSchedule("periodic")
+	assert.Error(t, err)
+}
+
+// scheduleSession creates a privileged session with the given schedule and seed
+func scheduleSession(t *testing.T, schedule Schedule, seed int64) *Session {
+	settings := DefaultSettings()
+	settings.IsPrivileged = true
+	settings.Interval = 100 * time.Millisecond
+	settings.Schedule = schedule
+	settings.Seed = seed
+
+	s, err := NewSession("localhost", settings)
+	assert.NoError(t, err)
+
+	return s
+}
+
+// sampleIntervals returns n intervals drawn by the session
+func sampleIntervals(s *Session, n int) []time.Duration {
+	intervals := make([]time.Duration, n)
+	for i := range intervals {
+		intervals[i] = s.nextInterval()
+	}
+
+	return intervals
+}
+
+// TestNextIntervalSeed verifies that sessions with the same seed draw the same intervals
+func TestNextIntervalSeed(t *testing.T) {
+	a := sampleIntervals(scheduleSession(t, SchedulePoisson, 42), 100)
+	b := sampleIntervals(scheduleSession(t, SchedulePoisson, 42), 100)
+	c := sampleIntervals(scheduleSession(t, SchedulePoisson, 43), 100)
+
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+}
+
+// TestNextIntervalFixed verifies that the fixed schedule always draws the interval
+func TestNextIntervalFixed(t *testing.T) {
+	for _, d := range sampleIntervals(scheduleSession(t, ScheduleFixed, 1), 10) {
+		assert.Equal(t, 100*time.Millisecond, d)
+	}
+}
+
+// TestNextIntervalJitter verifies that jittered intervals stay within the jitter and average to the interval
+func TestNextIntervalJitter(t *testing.T) {
+	s := scheduleSession(t, ScheduleJitter, 1)
+	s.settings.Jitter = 0.2
+
+	var sum time.Duration
+	intervals := sampleIntervals(s, 10000)
+	for _, d := range intervals {
+		assert.True(t, d >= 80*time.Millisecond && d <= 120*time.Millisecond, "interval %s out of bounds", d)
+		sum += d
+	}
+
+	assert.InDelta(t, float64(100*time.Millisecond), float64(sum)/float64(len(intervals)), float64(time.Millisecond))
+}
+
+// TestNextIntervalPoisson verifies that poisson intervals average to the interval, are never below the minimal
+// interval and vary as an exponential distribution does
+func TestNextIntervalPoisson(t *testing.T) {
+	intervals := sampleIntervals(scheduleSession(t, SchedulePoisson, 1), 10000)
+
+	var sum time.Duration
+	longer := 0
+	for _, d := range intervals {
+		assert.True(t, d >= minInterval)
+		sum += d
+		if d > 200*time.Millisecond {
+			longer++
+		}
+	}
+
+	// the minimal interval slightly raises the mean
+	assert.InDelta(t, float64(100*time.Millisecond), float64(sum)/float64(len(intervals)), float64(5*time.Millisecond))
+	// P(X > 2 * mean) = e^-2 for an exponential distribution
+	assert.InDelta(t, math.Exp(-2), float64(longer)/float64(len(intervals)), 0.02)
+}
+
+// TestSessionPoisson verifies that a session runs on a random schedule
+func TestSessionPoisson(t *testing.T) {
+	s, _ := fakeSession(t, 5)
+	s.settings.Schedule = SchedulePoisson
+	s.scheduleRand = newScheduleRand(7)
+
+	assert.NoError(t, s.Run())
+	assert.Equal(t, uint32(5), s.Stats.GetTotalSent())
+	assert.Equal(t, uint32(5), s.Stats.GetTotalRecv())
+}
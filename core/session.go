@@ -1,6 +1,8 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
@@ -9,7 +11,6 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/net/icmp"
 )
 
 // Session is an aggregation of ping executions
@@ -26,8 +27,17 @@ type Session struct {
 	// request with better accuracy.
 	bigID uint64
 
-	// lastSeq is the sequence number of the last sent echo request.
-	lastSeq int
+	// lastSeq is the extended sequence number of the last sent echo request, which does not wrap around at 65535.
+	lastSeq uint64
+
+	// preloadLastSeq is the extended seq of the last echo request of the preload burst, 0 if none was sent.
+	preloadLastSeq uint64
+
+	// rtt estimates the round trip time to compute timeouts with, as measured by the session as it waits for them.
+	rtt rttEstimator
+
+	// scheduleRand generates the random intervals of the schedule, only used by the session loop.
+	scheduleRand *rand.Rand
 
 	// lastSeqMutex is the mutex to make requests
 	reqMutex sync.Mutex
@@ -44,14 +54,35 @@ type Session struct {
 	// isIPv4 contains whether the stored address is IPv4 or not (IPv6)
 	isIPv4 bool
 
+	// bind contains the source address or the interface the connection is bound to, set by resolve
+	bind binding
+
 	// logger is an instance of logrus used to log activities related to this session
 	logger *log.Logger
 
-	// finishRequest is the channel that will signal a request to end the session run.
-	finishReqs chan error
+	// stopReqs is the channel that is closed to request the end of the session run.
+	stopReqs chan struct{}
+
+	// stopOnce ensures that stopReqs is closed only once.
+	stopOnce sync.Once
+
+	// errs is the channel that will carry errors that end the session run.
+	errs chan error
+
+	// updateReqs is the channel that signals that pendingPatch must be applied.
+	updateReqs chan struct{}
+
+	// pendingPatch contains the settings changes requested by Update and not applied yet, guarded by reqMutex.
+	pendingPatch SettingsPatch
+
+	// pauseReqs is the channel that signals that pauseRequested has changed.
+	pauseReqs chan struct{}
+
+	// pauseRequested contains whether sending echo requests must be paused, guarded by reqMutex.
+	pauseRequested bool
 
-	// finished is the channel that will signal the end of the session run.
-	finished chan bool
+	// doneReqs is the channel that signals that an echo request is done, so that the scheduler can react to it.
+	doneReqs chan struct{}
 
 	// isFinished contains whether the session has been finished
 	isStarted bool
@@ -68,25 +99,47 @@ type Session struct {
 	// reqW is responsible for synchronizing the hanging requests
 	reqW sync.WaitGroup
 
-	// onStart is a list of callback functions called when the session starts.
-	// The function parameters are the session and a sample first echo request.
-	onStart []func(*Session, *icmp.Message)
+	// outstanding contains the extended seqs of the echo requests that are waiting for a reply, in the order they were
+	// sent.
+	outstanding []uint64
 
-	// onSend is a list of callback functions called when an echo request is sent.
-	// The function parameters are the session and the message.
-	onSend []func(*Session)
+	// outstandingMutex is responsible for synchronizing reads and writes of outstanding
+	outstandingMutex sync.Mutex
 
-	// onRecv is a list of callback functions called when a round trip happens.
-	// The function parameters are the session.
-	onRecv []func(*Session, *RoundTrip)
+	// listen creates the connection used by the session run, replaceable to run sessions over fake connections.
+	listen func() (packetConn, error)
 
-	// onFinish is a list of callback functions called when the session ends.
-	// The function parameters are the session.
-	onFinish []func(*Session)
+	// clock is the source of time of the session.
+	clock Clock
+
+	// events is the channel where events are delivered, nil until Events is called.
+	events chan Event
+
+	// eventsClosed contains whether the session has emitted its last event.
+	eventsClosed bool
+
+	// droppedEvents is the amount of events dropped because events was full.
+	droppedEvents uint64
+
+	// eventsMutex is responsible for synchronizing reads and writes of events, eventsClosed and droppedEvents.
+	eventsMutex sync.Mutex
+
+	// emitMutex serializes the delivery of events so that they are received in the order they were emitted.
+	emitMutex sync.Mutex
+
+	// observers are notified of the events of the session, in the order they were added.
+	observers []Observer
+
+	// observersMutex is responsible for synchronizing reads and writes of observers.
+	observersMutex sync.Mutex
 }
 
 // NewSession creates a new Session
 func NewSession(address string, settings *Settings) (*Session, error) {
+	// the session keeps its own copy, as validating and updating the settings change them
+	copied := *settings
+	settings = &copied
+
 	logger := NewLogger(settings.LoggingLevel)
 
 	logger.Debug("Validating settings")
@@ -100,21 +153,33 @@ func NewSession(address string, settings *Settings) (*Session, error) {
 
 	r := rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
 
+	clock := settings.Clock
+	if clock == nil {
+		clock = SystemClock{}
+	}
+
 	session := &Session{
-		Stats:      NewStatistics(),
-		lastSeq:    0,
-		finishReqs: make(chan error, 1),
-		finished:   make(chan bool, 1),
-		id:         r.Intn(math.MaxUint16),
-		bigID:      r.Uint64(),
-		rMap:       newReplyMap(),
-		settings:   settings,
-		iaddr:      address,
-		logger:     logger,
-		isStarted:  false,
-		isFinished: false,
+		Stats:        newStatistics(clock),
+		lastSeq:      0,
+		stopReqs:     make(chan struct{}),
+		errs:         make(chan error, 1),
+		updateReqs:   make(chan struct{}, 1),
+		pauseReqs:    make(chan struct{}, 1),
+		doneReqs:     make(chan struct{}, 1),
+		scheduleRand: newScheduleRand(settings.Seed),
+		id:           r.Intn(math.MaxUint16),
+		bigID:        r.Uint64(),
+		rMap:         newReplyMap(),
+		clock:        clock,
+		settings:     settings,
+		iaddr:        address,
+		logger:       logger,
+		isStarted:    false,
+		isFinished:   false,
 	}
 
+	session.listen = session.getConnection
+
 	session.AddOnStart(initStatsCb)
 	session.AddOnFinish(finishStatsCb)
 
@@ -124,78 +189,185 @@ func NewSession(address string, settings *Settings) (*Session, error) {
 	return session, nil
 }
 
-// Run executes the sequence of pings
+// Run executes the sequence of pings, it is the same as RunContext with a context that is never done.
 func (s *Session) Run() error {
-	if s.IsFinished() {
+	return s.RunContext(context.Background())
+}
+
+// RunContext executes the sequence of pings until the count or deadline settings are reached, RequestStop is called
+// or ctx is done. It returns nil in the first two cases and ctx.Err() in the latter, calling the finish handlers in
+// all of them. Any other error means the session could not run properly, in which case the finish handlers are not
+// called. Every goroutine started by the session has returned by the time RunContext returns.
+func (s *Session) RunContext(ctx context.Context) (err error) {
+	s.statusMutex.Lock()
+	if s.isFinished {
+		s.statusMutex.Unlock()
 		return fmt.Errorf("this session has already finished")
 	}
-	if s.IsStarted() {
+	if s.isStarted {
+		s.statusMutex.Unlock()
 		return fmt.Errorf("this session has already started")
 	}
+	s.isStarted = true
+	s.statusMutex.Unlock()
 
-	defer close(s.finishReqs)
-	s.setIsStarted(true)
+	defer s.setIsFinished(true) // also covers runs ending with an error
+	defer func() {
+		if err != nil && err != ctx.Err() {
+			s.emit(Event{Type: EventError, Err: err})
+		}
+		s.closeEvents()
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	if !s.settings.IsPrivileged {
 		s.logger.Warnf("You are running as non-privileged, meaning that it is not possible to receive TimeExceeded ICMP"+
 			" messages. Echo requests that exceed the configured TTL of %d will be treated as timed out", s.settings.TTL)
 	}
 
-	err := s.resolve()
+	err = s.resolve()
 	if err != nil {
 		return err
 	}
 
 	s.logger.Info("Calling start callbacks")
-	for _, f := range s.onStart {
-		f(s, s.buildEchoRequest(0))
+	sample := s.buildEchoRequest(0)
+	s.notify(func(o Observer) { o.OnStart(s, sample) })
+	s.emit(Event{Type: EventStarted})
+
+	// settings updated before the run are applied before creating the connection, which depends on them
+	select {
+	case <-s.updateReqs:
+		if _, err = s.handleUpdateRequest(nil, nil); err != nil {
+			return err
+		}
+	default:
 	}
 
-	conn, err := s.getConnection()
+	conn, err := s.listen()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
+	// every goroutine started from now on watches runCtx to know when to return
+	runCtx, cancelCtx := context.WithCancel(ctx)
+	defer cancelCtx()
+
+	// the poller blocks on reads until a packet arrives, closing the connection is what wakes it up on a stop
+	cancel := func() {
+		cancelCtx()
+		conn.Close()
+	}
+
 	// channel that will stream all incoming ICMP packets
 	s.logger.Debug("Creating channel of incoming raw packets")
 	rawPackets := make(chan *rawPacket, 5)
-	defer close(rawPackets)
 
 	// start receiving incoming ICMP packets using a controlgroup to properly exit later
 	s.logger.Info("Calling goroutine to poll for incoming raw packets")
 	var wg sync.WaitGroup
 	wg.Add(1)
-	go s.pollConnection(&wg, conn, rawPackets)
+	go s.pollConnection(runCtx, &wg, conn, rawPackets)
 
-	deadline, interval := s.initTimers()
+	deadline, sched := s.initTimers()
 	defer deadline.Stop()
-	defer interval.Stop()
+	defer func() { sched.Stop() }()
+
+	// closed once the request limit is reached and all pending requests are done, nil until then
+	var drained <-chan struct{}
+
+	// fires once the request limit has been reached for the linger setting, nil until then or if it is not set
+	var linger <-chan time.Time
+
+	// a session paused before the run does not send its first echo request
+	paused := false
+	select {
+	case <-s.pauseReqs:
+		paused, sched = s.handlePauseRequest(paused, sched)
+	default:
+	}
 
-	go s.handleIntervalTimer(conn, interval)
+	if !paused {
+		s.sendNext(runCtx, conn)
+		sched.sent(s.clock.Now())
+	}
 
 	for {
+		// no echo request is sent while paused
+		tick := sched.C()
+		if paused {
+			tick = nil
+		}
+
 		select {
-		case <-deadline.C:
-			s.handleDeadlineTimer()
-		case <-interval.C:
-			go s.handleIntervalTimer(conn, interval)
+		case <-ctx.Done():
+			s.handleFinish(cancel, &wg)
+			return ctx.Err()
+		case <-s.stopReqs:
+			s.handleFinish(cancel, &wg)
+			return nil
+		case <-drained:
+			s.handleFinish(cancel, &wg)
+			return nil
+		case <-linger:
+			s.logger.Info("Stopped waiting for the pending requests after lingering")
+			s.handleFinish(cancel, &wg)
+			return nil
+		case <-deadline.C():
+			if s.handleDeadlineTimer() {
+				s.handleFinish(cancel, &wg)
+				return nil
+			}
+		case <-tick:
+			if s.reachedRequestLimit() {
+				s.logger.Trace("Not firing more requests as we have reached the set count")
+				sched.Stop()
+				if drained == nil {
+					drained = s.drain()
+					if s.settings.Linger > 0 {
+						lingerTimer := s.clock.NewTimer(s.settings.Linger)
+						defer lingerTimer.Stop()
+						linger = lingerTimer.C()
+					}
+				}
+				continue
+			}
+			s.sendNext(runCtx, conn)
+			sched.sent(s.clock.Now())
+		case <-s.doneReqs:
+			if s.reachedReplyLimit() {
+				s.logger.Info("Received the set count of replies before the deadline")
+				s.handleFinish(cancel, &wg)
+				return nil
+			}
+			sched.done(s.outstandingCount())
+		case <-s.pauseReqs:
+			paused, sched = s.handlePauseRequest(paused, sched)
+		case <-s.updateReqs:
+			if sched, err = s.handleUpdateRequest(conn, sched); err != nil {
+				s.logger.Errorf("Could not update the session settings: %s", err)
+			}
 		case raw := <-rawPackets:
 			s.handleRawPacket(raw)
-		case err := <-s.finishReqs:
-			return s.handleFinishRequest(err, &wg)
+			raw.release()
+		case err := <-s.errs:
+			s.stopRun(cancel, &wg)
+			return err
 		}
 	}
 }
 
-// RequestStop requests the stop the execution of the session
+// RequestStop requests the stop of the execution of the session, which then finishes normally.
+// It is safe to call it more than once and at any moment, even before the session starts running.
 func (s *Session) RequestStop() {
-	if s.IsFinished() {
-		return
-	}
-
-	s.logger.Info("Requesting to end session")
-	s.finishReqs <- nil
+	s.stopOnce.Do(func() {
+		s.logger.Info("Requesting to end session")
+		close(s.stopReqs)
+	})
 }
 
 // IsStarted returns whether this session is started
@@ -224,24 +396,26 @@ func (s *Session) CNAME() string {
 	return s.cname
 }
 
-// AddOnStart adds a handler function that will be called when the session starts
-func (s *Session) AddOnStart(handler func(*Session, *icmp.Message)) {
-	s.onStart = append(s.onStart, handler)
-}
+// Settings returns a copy of the current settings of the session, which reflects the updates applied so far.
+func (s *Session) Settings() Settings {
+	s.reqMutex.Lock()
+	defer s.reqMutex.Unlock()
 
-// AddOnSend adds a handler function that will be called after an echo request is replied or expires
-func (s *Session) AddOnSend(handler func(*Session)) {
-	s.onSend = append(s.onSend, handler)
+	return *s.settings
 }
 
-// AddOnRecv adds a handler function that will be called after an echo request is replied or expires
-func (s *Session) AddOnRecv(handler func(*Session, *RoundTrip)) {
-	s.onRecv = append(s.onRecv, handler)
-}
+// Outstanding returns the 16-bit seqs of the echo requests that have been sent and are still waiting for a reply or
+// timeout, in the order they were sent.
+func (s *Session) Outstanding() []int {
+	s.outstandingMutex.Lock()
+	defer s.outstandingMutex.Unlock()
 
-// AddOnFinish adds a handler function that will be called when the session ends
-func (s *Session) AddOnFinish(handler func(*Session)) {
-	s.onFinish = append(s.onFinish, handler)
+	seqs := make([]int, 0, len(s.outstanding))
+	for _, seq := range s.outstanding {
+		seqs = append(seqs, int(uint16(seq)))
+	}
+
+	return seqs
 }
 
 // resolve resolves the input address setting the session ip address and cname
@@ -253,9 +427,23 @@ func (s *Session) resolve() error {
 		return fmt.Errorf("error while resolving address %s: %w", s.iaddr, err)
 	}
 
-	cname, err := net.LookupCNAME(s.iaddr)
+	// interfaces are looked up where the socket is created
+	var bind binding
+	err = s.inNetns(func() (err error) {
+		bind, err = s.resolveBinding(ipaddr)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("error while looking up cname of address %s: %w", s.iaddr, err)
+		return err
+	}
+
+	// IP addresses have no cname, and link-local ones could not be looked up anyway
+	cname := s.iaddr
+	if ip, _ := splitZone(s.iaddr); ip == nil {
+		cname, err = net.LookupCNAME(s.iaddr)
+		if err != nil {
+			return fmt.Errorf("error while looking up cname of address %s: %w", s.iaddr, err)
+		}
 	}
 
 	s.logger.Infof("Address %s resolved to IP Address %s", s.iaddr, ipaddr.String())
@@ -273,105 +461,233 @@ func (s *Session) resolve() error {
 
 	s.cname = cname
 	s.isIPv4 = ipv4
+	s.bind = bind
 	s.addr = resAddr
 	return nil
 }
 
+// resolveBinding returns the binding of the session according to its settings, filling the zones it implies in ipaddr.
+func (s *Session) resolveBinding(ipaddr *net.IPAddr) (binding, error) {
+	bind, err := parseInterface(s.settings.Interface)
+	if err != nil {
+		return binding{}, err
+	}
+
+	if err := bind.setVRF(s.settings.VRF); err != nil {
+		return binding{}, err
+	}
+
+	if err := bind.bindTo(ipaddr); err != nil {
+		return binding{}, err
+	}
+
+	return bind, nil
+}
+
 // initTimers initializes all timers used to manage the session flow
-func (s *Session) initTimers() (deadline *time.Timer, interval *time.Ticker) {
+func (s *Session) initTimers() (deadline Timer, sched scheduler) {
 	// timer responsible for shutting down the execution, if enabled
 	s.logger.Debugf("Initializing deadline timer to duration %s", s.getDeadlineDuration())
-	deadline = time.NewTimer(s.getDeadlineDuration())
+	deadline = s.clock.NewTimer(s.getDeadlineDuration())
 
-	// timer responsible for handling the interval between two requests
-	s.logger.Debugf("Initializing interval ticker to duration %s", s.getIntervalDuration())
-	interval = time.NewTicker(s.getIntervalDuration())
+	// scheduler responsible for handling the interval between two requests
+	sched = s.newScheduler(s.outstandingCount())
 
-	return deadline, interval
+	return deadline, sched
 }
 
-// handleTimeoutTimer is responsible for handling when the deadline timer is triggered, checking if the deadline
-// option is active and whether we should terminate the session.
-func (s *Session) handleDeadlineTimer() {
+// handleDeadlineTimer is responsible for handling when the deadline timer is triggered, returning whether the deadline
+// option is active and therefore we should terminate the session.
+func (s *Session) handleDeadlineTimer() bool {
 	s.logger.Info("Deadline timer has fired")
 
 	if !s.isDeadlineActive() {
 		s.logger.Info("Ignoring deadline timer because the deadline config has not been activated")
-		return
+		return false
 	}
 
 	// deadline is active and triggered, let's end everything
 	s.logger.Info("Requesting to finish the session")
-	s.finishReqs <- nil
+	return true
 }
 
-// handleIntervalTimer is responsible for handling when the interval timer is triggered, sending a new echo request.
-func (s *Session) handleIntervalTimer(conn *icmp.PacketConn, interval *time.Ticker) {
-	s.logger.Trace("Interval ticker has been triggered")
-
-	if s.reachedRequestLimit() {
-		s.logger.Trace("Not firing more requests as we have reached the set count")
-		interval.Stop()
+// sendNext sends the next echo request, or the preload burst if nothing has been sent yet.
+func (s *Session) sendNext(ctx context.Context, conn packetConn) {
+	if s.lastSeq == 0 && s.settings.Preload > 0 {
+		s.sendPreload(ctx, conn)
+		return
+	}
 
-		s.reqW.Wait()
+	s.handleIntervalTimer(ctx, conn)
+}
 
-		s.logger.Info("Requesting to finish the session")
-		s.finishReqs <- nil
-		return
+// sendPreload sends the echo requests of the preload burst back-to-back, up to the request limit.
+func (s *Session) sendPreload(ctx context.Context, conn packetConn) {
+	n := uint64(s.settings.Preload)
+	if s.isMaxCountActive() && n > uint64(s.settings.MaxCount) {
+		n = uint64(s.settings.MaxCount)
 	}
 
-	s.reqMutex.Lock()
+	s.logger.Infof("Sending preload burst of %d echo requests", n)
 
-	if s.IsFinished() {
-		s.logger.Info("Exiting interval timer handler because the session has been finished")
-		s.reqMutex.Unlock()
-		return
+	// set before sending so that every round trip of the burst is recognized as such
+	s.preloadLastSeq = s.lastSeq + n
+	for i := uint64(0); i < n; i++ {
+		s.Stats.BurstEchoRequested()
+		s.handleIntervalTimer(ctx, conn)
 	}
+}
+
+// isPreloadSeq returns whether the echo request with the extended seq was sent in the preload burst.
+func (s *Session) isPreloadSeq(seq uint64) bool {
+	return seq <= s.preloadLastSeq
+}
+
+// handleIntervalTimer is responsible for handling when the interval timer is triggered, sending a new echo request
+// and starting a goroutine that waits for its reply until it times out or ctx is done.
+func (s *Session) handleIntervalTimer(ctx context.Context, conn packetConn) {
+	s.logger.Trace("Interval ticker has been triggered")
+
+	s.reqMutex.Lock()
 
 	selectedSeq := s.lastSeq + 1
 	s.Stats.EchoRequested()
-	s.lastSeq = (s.lastSeq + 1) & 0xffff
+	s.lastSeq = selectedSeq
+
+	// registering before sending so that a fast reply is never taken for one that has already timed out
+	ch := s.rMap.GetOrCreate(selectedSeq)
+	s.addOutstanding(selectedSeq)
 
-	err := s.sendEchoRequest(conn, selectedSeq)
+	timeout := s.getTimeoutDuration()
+	msg, sent, err := s.sendEchoRequest(conn, selectedSeq)
 	s.logger.Infof("Incrementing number of packages sent and of last sequence to %d and %d respectively",
 		s.Stats.GetTotalSent(), s.lastSeq)
 
 	s.reqMutex.Unlock()
 
-	for _, f := range s.onSend {
-		f(s)
+	if err != nil && isMessageTooLong(err) {
+		s.rMap.Erase(selectedSeq)
+		s.removeOutstanding(selectedSeq)
+		s.logger.Warnf("Echo request of %d bytes is too long to be sent: %s", len(msg), err)
+		s.processRoundTrip(buildMessageTooLongRT(selectedSeq, sent.wall, len(msg)))
+		s.signalDone()
+		return
 	}
-
 	if err != nil {
+		s.rMap.Erase(selectedSeq)
+		s.removeOutstanding(selectedSeq)
 		s.Stats.EchoRequestError()
 		s.logger.Errorf("Could not send echo request: %s", err)
+		s.notify(func(o Observer) { o.OnSendError(s, selectedSeq, err) })
+		s.emit(Event{Type: EventError, Seq: selectedSeq, Err: err})
+		s.signalDone()
 		return
 	}
+	s.notify(func(o Observer) { o.OnSend(s, selectedSeq, msg) })
+	s.emit(Event{Type: EventSent, Time: sent.wall, Seq: selectedSeq})
 
-	ch := s.rMap.GetOrCreate(uint16(selectedSeq))
-	defer s.rMap.Erase(uint16(selectedSeq))
+	// the kernel may tell when the request actually left, zero otherwise
+	var kernelSentAt time.Time
+	if ts, ok := conn.(sendTimestamper); ok {
+		kernelSentAt, _ = ts.lastSent()
+	}
 
 	s.reqW.Add(1)
+	go s.awaitReply(ctx, selectedSeq, sent, kernelSentAt, timeout, ch)
+}
+
+// awaitReply waits for the reply of the echo request with seq for up to timeout and processes the resulting round
+// trip. If ctx is done first, it returns without processing anything and the request is left pending.
+// sent is the time the session sent the request and kernelSentAt the time the kernel did, zero if unknown.
+func (s *Session) awaitReply(ctx context.Context, seq uint64, sent instant, kernelSentAt time.Time,
+	timeout time.Duration, ch <-chan *RoundTrip) {
 	defer s.reqW.Done()
+	defer s.signalDone()
+	defer s.rMap.Erase(seq)
+	defer s.removeOutstanding(seq)
+
+	timer := s.clock.NewTimer(timeout)
+	defer timer.Stop()
 
-	timeout := s.getTimeoutDuration()
 	select {
 	case rt := <-ch:
-		if rt == nil {
-			s.Stats.EchoRequestError()
-			break
+		measureRoundTrip(rt, sent, kernelSentAt)
+		if rt.ClockDiverged {
+			s.logger.Warnf("Wall clock diverged from the monotonic clock during the round trip of seq %d", seq)
 		}
-
-		go s.processRoundTrip(rt)
-	case <-time.After(timeout):
-		rt := buildTimedOutRT(selectedSeq, timeout)
-		go s.processRoundTrip(rt)
-	case err := <-s.finishReqs:
+		s.processRoundTrip(rt)
+	case <-timer.C():
+		rt := buildTimedOutRT(seq, sent.wall, timeout)
+		s.processRoundTrip(rt)
+	case <-ctx.Done():
 		// we should exit and not wait anymore
-		s.finishReqs <- err
 	}
 }
 
+// drain returns a channel that is closed once every pending echo request is done.
+// No echo request must be sent after calling it.
+func (s *Session) drain() <-chan struct{} {
+	drained := make(chan struct{})
+	go func() {
+		s.reqW.Wait()
+		close(drained)
+	}()
+
+	return drained
+}
+
+// addOutstanding adds seq to the list of echo requests waiting for a reply.
+func (s *Session) addOutstanding(seq uint64) {
+	s.outstandingMutex.Lock()
+	defer s.outstandingMutex.Unlock()
+
+	s.outstanding = append(s.outstanding, seq)
+}
+
+// removeOutstanding removes seq from the list of echo requests waiting for a reply.
+func (s *Session) removeOutstanding(seq uint64) {
+	s.outstandingMutex.Lock()
+	defer s.outstandingMutex.Unlock()
+
+	for i, val := range s.outstanding {
+		if val == seq {
+			s.outstanding = append(s.outstanding[:i], s.outstanding[i+1:]...)
+			return
+		}
+	}
+}
+
+// outstandingCount returns the amount of echo requests waiting for a reply.
+func (s *Session) outstandingCount() int {
+	s.outstandingMutex.Lock()
+	defer s.outstandingMutex.Unlock()
+
+	return len(s.outstanding)
+}
+
+// signalDone signals the session loop that an echo request is done, without blocking.
+func (s *Session) signalDone() {
+	select {
+	case s.doneReqs <- struct{}{}:
+	default:
+		// a signal is already pending, the loop checks every outstanding request when handling it
+	}
+}
+
+// extendSeq returns the extended seq of the oldest outstanding echo request whose 16-bit seq is seq.
+func (s *Session) extendSeq(seq int) (uint64, bool) {
+	s.outstandingMutex.Lock()
+	defer s.outstandingMutex.Unlock()
+
+	for _, val := range s.outstanding {
+		if uint16(val) == uint16(seq) {
+			return val, true
+		}
+	}
+
+	return 0, false
+}
+
 // handleRawPacket is responsible for properly handling an incoming raw packet from our connection.
 func (s *Session) handleRawPacket(raw *rawPacket) {
 
@@ -380,71 +696,115 @@ func (s *Session) handleRawPacket(raw *rawPacket) {
 	// checks whether this ICMP is the reply of the last request and process it
 	rt, err := s.preProcessRawPacket(raw)
 
+	var icmpErr *icmpErrorMessage
+	if errors.As(err, &icmpErr) {
+		s.logger.Infof("Received raw packet is an ICMP error message: %s", err)
+		s.notify(func(o Observer) { o.OnICMPError(s, icmpErr.seq, icmpErr.msg) })
+		return
+	}
+
 	if err != nil {
 		s.logger.Errorf("Could not parse raw packet: %s", err)
+		s.notifyUnmatched(raw)
 		return
 	}
 
 	if rt == nil {
 		s.logger.Info("Received raw packet was not a match")
+		s.notifyUnmatched(raw)
 		return
 	}
 
-	ch, ok := s.rMap.Get(uint16(rt.Seq))
+	if rt.Res == TTLExpired {
+		// time exceeded messages only carry the 16-bit seq of the original request
+		extSeq, ok := s.extendSeq(rt.Seq)
+		if !ok {
+			s.logger.Info("Received raw packet from seq that is not outstanding")
+			s.notifyUnmatched(raw)
+			return
+		}
+		rt.ExtSeq = extSeq
+	}
+
+	ch, ok := s.rMap.Get(rt.ExtSeq)
 	if !ok {
 		s.logger.Info("Received raw packet from seq that has already timed out")
+		s.notifyUnmatched(raw)
 		return
 	}
 
-	ch <- rt
+	select {
+	case ch <- rt:
+	default:
+		s.logger.Info("Received raw packet from seq that has already been replied")
+		s.notifyUnmatched(raw)
+	}
+}
+
+// notifyUnmatched notifies the observers of a packet that does not match any outstanding echo request.
+func (s *Session) notifyUnmatched(raw *rawPacket) {
+	packet := raw.content[:raw.length]
+	s.notify(func(o Observer) { o.OnUnmatched(s, packet) })
 }
 
-// handleFinishRequest handles where we should finish the session.
-func (s *Session) handleFinishRequest(err error, wg *sync.WaitGroup) error {
-	s.reqMutex.Lock()
-	defer s.reqMutex.Unlock()
+// stopRun stops every goroutine of the session run, returning once all of them have returned.
+func (s *Session) stopRun(cancel context.CancelFunc, wg *sync.WaitGroup) {
+	s.logger.Info("Stopping all goroutines of the session")
 
-	if err != nil {
-		return err
-	}
+	cancel()
+	wg.Wait()     // waiting for polling to return
+	s.reqW.Wait() // waiting for the pending requests to return
+}
 
+// handleFinish stops the session run and calls the finish callbacks.
+func (s *Session) handleFinish(cancel context.CancelFunc, wg *sync.WaitGroup) {
 	s.logger.Info("Finish request received")
 
-	s.finishReqs <- nil // forwarding to polling if it did not come from there
-	wg.Wait()           // waiting for polling to return
-
-	s.finished <- true // sending to stop, if it came from there
+	s.stopRun(cancel, wg)
 	s.setIsFinished(true)
 
 	s.logger.Info("Calling ending callbacks")
-	for _, f := range s.onFinish {
-		f(s)
-	}
+	s.notify(func(o Observer) { o.OnFinish(s) })
 
 	s.logger.Info("Session ended")
-	return nil
 }
 
-// Returns the deadline setting parsed as a duration in seconds.
+// reportError reports an error that must end the session run, it is dropped if another one has been reported.
+func (s *Session) reportError(err error) {
+	select {
+	case s.errs <- err:
+	default:
+		s.logger.Errorf("Dropping error as the session is already ending: %s", err)
+	}
+}
+
+// Returns the deadline setting.
 func (s *Session) getDeadlineDuration() time.Duration {
-	return time.Second * time.Duration(s.settings.Deadline)
+	return s.settings.Deadline
 }
 
-// Returns the interval setting parsed as a duration in seconds.
+// Returns the interval setting.
 func (s *Session) getIntervalDuration() time.Duration {
-	return time.Duration(float64(time.Second) * s.settings.Interval)
+	return s.settings.Interval
 }
 
-// Returns the appropriate value for the next timeout parsed as a duration in seconds.
+// Returns the appropriate value for the next timeout according to the timeout policy.
 func (s *Session) getTimeoutDuration() time.Duration {
+	switch s.settings.TimeoutPolicy {
+	case TimeoutIPutils:
+		// if we already have successful pings, our timeout is now 2 times
+		// the longest registered rtt, as the original ping does
+		if rtt, ok := s.rtt.maxRTT(); ok {
+			return 2 * rtt
+		}
+	case TimeoutRFC6298:
+		if rto, ok := s.rtt.rto(); ok {
+			return rto
+		}
+	}
 
-	// if we already have successful pings, our timeout is now 2 times
-	// the longest registered rtt, as the original ping does
 	// otherwise, we use the standard timeout
-	if s.Stats.GetTotalRecv() > 0 {
-		return time.Duration(2 * s.Stats.GetRTTMax())
-	}
-	return time.Second * time.Duration(s.settings.Timeout)
+	return s.settings.Timeout
 }
 
 // setIsFinished updates the isFinished property to val
@@ -455,14 +815,6 @@ func (s *Session) setIsFinished(val bool) {
 	s.isFinished = val
 }
 
-// setIsStarted updates the isStarted property to val
-func (s *Session) setIsStarted(val bool) {
-	s.statusMutex.Lock()
-	defer s.statusMutex.Unlock()
-
-	s.isStarted = val
-}
-
 // Returns whether the deadline setting is active.
 func (s *Session) isDeadlineActive() bool {
 	return s.settings.Deadline > 0
@@ -474,9 +826,18 @@ func (s *Session) isMaxCountActive() bool {
 }
 
 // reachedRequestLimit whether we ahave reached the request limit of this session.
+// With a deadline, the count is a limit of replies instead, see reachedReplyLimit.
 func (s *Session) reachedRequestLimit() bool {
 	// checks if we have to stop somewhere and if we are already there
-	return s.isMaxCountActive() && int64(s.Stats.GetTotalSent()) >= int64(s.settings.MaxCount)
+	return s.isMaxCountActive() && !s.isDeadlineActive() &&
+		int64(s.Stats.GetTotalSent()) >= int64(s.settings.MaxCount)
+}
+
+// reachedReplyLimit returns whether the session has both a count and a deadline and has received count replies, in
+// which case it ends before the deadline, as ping does.
+func (s *Session) reachedReplyLimit() bool {
+	return s.isMaxCountActive() && s.isDeadlineActive() &&
+		int64(s.Stats.GetTotalRecv()) >= int64(s.settings.MaxCount)
 }
 
 // processRoundTrip calls all handlers for a round trip.
@@ -485,13 +846,23 @@ func (s *Session) processRoundTrip(rt *RoundTrip) {
 		return
 	}
 
-	if rt.Res == Replied {
+	switch rt.Res {
+	case Replied:
 		rtt := rt.Time.Nanoseconds()
 		s.Stats.EchoReplied(uint64(rtt))
+		s.rtt.update(rt.timeoutRTT())
+		if s.isPreloadSeq(rt.ExtSeq) {
+			s.Stats.BurstEchoReplied()
+		}
+	case TimedOut:
+		s.Stats.EchoTimedOut()
+	case TTLExpired:
+		s.Stats.EchoTTLExpired()
+	case MessageTooLong:
+		s.Stats.EchoMessageTooLong()
 	}
 
 	s.logger.Info("Calling all handlers for latest round trip")
-	for _, f := range s.onRecv {
-		f(s, rt)
-	}
+	s.notify(func(o Observer) { o.OnRoundTrip(s, rt) })
+	s.emit(Event{Type: EventRoundTrip, RoundTrip: rt})
 }
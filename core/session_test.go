@@ -1,7 +1,10 @@
 package core
 
 import (
+	"context"
+	"fmt"
 	"math"
+	"net"
 	"sync"
 	"testing"
 	"time"
@@ -16,11 +19,9 @@ func TestNewSession(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, s)
 
-	assert.Equal(t, 0, s.lastSeq)
+	assert.Equal(t, uint64(0), s.lastSeq)
 	assert.GreaterOrEqual(t, math.MaxUint16, s.id)
-	assert.Len(t, s.onStart, 1, "new session does not start with one st handler")
-	assert.Len(t, s.onFinish, 1, "new session does not start with one end handler")
-	assert.Empty(t, s.onRecv, "new session does not start with empty rt handlers")
+	assert.Len(t, s.observers, 2, "new session does not start with the stats start and end handlers")
 
 	assert.False(t, s.isStarted)
 	assert.False(t, s.isFinished)
@@ -52,6 +53,66 @@ func TestSessionStop(t *testing.T) {
 	}
 }
 
+// TestSessionRequestStopBeforeRun verifies that a stop requested
+// before the session runs ends the run as soon as it starts
+func TestSessionRequestStopBeforeRun(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+	assert.NotNil(t, s)
+
+	s.RequestStop()
+	s.RequestStop()
+
+	assert.NoError(t, s.Run())
+	assert.True(t, s.IsStarted())
+	assert.True(t, s.IsFinished())
+	assert.Error(t, s.Run())
+}
+
+// TestSessionRunContextCanceled verifies that a session run with a canceled
+// context returns the context error without running
+func TestSessionRunContextCanceled(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+	assert.NotNil(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, s.RunContext(ctx))
+	assert.True(t, s.IsFinished())
+	assert.Zero(t, s.Stats.GetTotalSent())
+}
+
+// TestSessionRunContextDeadline verifies that the deadline of the context
+// ends the session, calling the finish handlers and returning the context error
+func TestSessionRunContextDeadline(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+	assert.NotNil(t, s)
+
+	finished := make(chan bool, 1)
+	s.AddOnFinish(func(*Session) { finished <- true })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	c1 := make(chan error, 1)
+	go func() {
+		c1 <- s.RunContext(ctx)
+	}()
+
+	select {
+	case err := <-c1:
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.True(t, s.IsFinished())
+		assert.NotEmpty(t, finished)
+		assert.Empty(t, s.Outstanding())
+	case <-time.After(1 * time.Second):
+		t.Error("Context deadline did not stop the session in time")
+	}
+}
+
 // TestSessionAddr verifies if the getter is correct
 func TestSessionAddr(t *testing.T) {
 	s, err := NewSession("localhost", DefaultSettings())
@@ -77,10 +138,31 @@ func TestSessionAddOnRecv(t *testing.T) {
 	assert.NotNil(t, s)
 
 	h := func(*Session, *RoundTrip) {}
-	prevlen := len(s.onRecv)
+	prevlen := len(s.observers)
 
 	s.AddOnRecv(h)
-	assert.Equal(t, prevlen+1, len(s.onRecv))
+	assert.Equal(t, prevlen+1, len(s.observers))
+}
+
+// TestSessionOutstanding verifies that outstanding requests are kept in the order they were sent
+func TestSessionOutstanding(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+	assert.NotNil(t, s)
+
+	assert.Empty(t, s.Outstanding())
+
+	s.addOutstanding(65535)
+	s.addOutstanding(0)
+	s.addOutstanding(1)
+	assert.Equal(t, []int{65535, 0, 1}, s.Outstanding())
+
+	s.removeOutstanding(0)
+	assert.Equal(t, []int{65535, 1}, s.Outstanding())
+
+	s.removeOutstanding(65535)
+	s.removeOutstanding(1)
+	assert.Empty(t, s.Outstanding())
 }
 
 // TestSessionAddOnStart verifies that a function is correctly added to the list
@@ -90,10 +172,10 @@ func TestSessionAddOnStart(t *testing.T) {
 	assert.NotNil(t, s)
 
 	h := func(*Session, *icmp.Message) {}
-	prevlen := len(s.onStart)
+	prevlen := len(s.observers)
 
 	s.AddOnStart(h)
-	assert.Equal(t, prevlen+1, len(s.onStart))
+	assert.Equal(t, prevlen+1, len(s.observers))
 }
 
 // TestSessionAddOnEnd verifies that a function is correctly added to the list
@@ -103,10 +185,10 @@ func TestSessionAddOnEnd(t *testing.T) {
 	assert.NotNil(t, s)
 
 	h := func(*Session) {}
-	prevlen := len(s.onFinish)
+	prevlen := len(s.observers)
 
 	s.AddOnFinish(h)
-	assert.Equal(t, prevlen+1, len(s.onFinish))
+	assert.Equal(t, prevlen+1, len(s.observers))
 }
 
 // TODO(how): Implement this test when we refactor the code to use interfaces allowing us to mock
@@ -138,15 +220,14 @@ func TestSessionHandleDeadlineTimer1(t *testing.T) {
 
 	assert.False(t, s.isDeadlineActive())
 
-	s.handleDeadlineTimer()
-	assert.Empty(t, s.finishReqs)
+	assert.False(t, s.handleDeadlineTimer())
 }
 
 // TestSessionHandleDeadlineTimer2 verifies the proper behavior
 // of the handler when the deadline is active
 func TestSessionHandleDeadlineTimer2(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Deadline = 1
+	settings.Deadline = time.Second
 	settings.IsDeadlineDefault = false
 
 	s, err := NewSession("localhost", settings)
@@ -155,17 +236,49 @@ func TestSessionHandleDeadlineTimer2(t *testing.T) {
 
 	assert.True(t, s.isDeadlineActive())
 
-	s.handleDeadlineTimer()
-	assert.NotEmpty(t, s.finishReqs)
+	assert.True(t, s.handleDeadlineTimer())
 }
 
-// TODO(how): Implement this test when we refactor the code to use interfaces allowing us to mock
+// TestSessionHandleIntervalTimer verifies that an echo request is sent and times out once the clock has advanced by
+// the timeout
 func TestSessionHandleIntervalTimer(t *testing.T) {
-	s, err := NewSession("localhost", DefaultSettings())
-	assert.NoError(t, err)
-	assert.NotNil(t, s)
+	clock := newTestClock()
+	settings := DefaultSettings()
+	settings.Clock = clock
+	settings.Timeout = time.Second
+	settings.TimeoutPolicy = TimeoutFixed
 
-	// s.handleIntervalTimer()
+	s, err := NewSession("localhost", settings)
+	assert.NoError(t, err)
+	s.isIPv4 = true
+	s.addr = &net.IPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+	rts := make(chan *RoundTrip, 1)
+	s.AddOnRecv(func(_ *Session, rt *RoundTrip) {
+		rts <- rt
+	})
+
+	conn := newFakeConn(true)
+	conn.drop = func(seq uint64) bool { return true }
+	start := clock.Now()
+	s.handleIntervalTimer(context.Background(), conn)
+
+	assert.Equal(t, uint32(1), s.Stats.GetTotalSent())
+	assert.Equal(t, []int{1}, s.Outstanding())
+
+	clock.BlockUntil(1)
+	clock.Advance(999 * time.Millisecond)
+	assert.Len(t, rts, 0)
+
+	clock.Advance(time.Millisecond)
+	rt := <-rts
+	s.reqW.Wait()
+
+	assert.Equal(t, TimedOut, rt.Res)
+	assert.Equal(t, start, rt.Sent)
+	assert.Equal(t, time.Second, rt.Time)
+	assert.Equal(t, uint32(1), s.Stats.GetTotalTimedOut())
+	assert.Empty(t, s.Outstanding())
 }
 
 // TestSessionHandleRawPacket1 verifies the proper behavior
@@ -179,10 +292,10 @@ func TestSessionHandleRawPacket1(t *testing.T) {
 	pkt, err := buildEchoReply(s.id, s.lastSeq, s.bigID, s.isIPv4)
 	assert.NoError(t, err)
 
-	ch := s.rMap.GetOrCreate(uint16(s.lastSeq))
+	ch := s.rMap.GetOrCreate(s.lastSeq)
 
 	s.handleRawPacket(pkt)
-	assert.Empty(t, s.finishReqs)
+	assert.Empty(t, s.errs)
 	assert.NotEmpty(t, ch)
 }
 
@@ -197,17 +310,17 @@ func TestSessionHandleRawPacket2(t *testing.T) {
 	pkt, err := buildTimeExceeded(uint16(s.id), uint16(s.lastSeq), s.isIPv4)
 	assert.NoError(t, err)
 
-	ch := s.rMap.GetOrCreate(uint16(s.lastSeq))
+	ch := s.rMap.GetOrCreate(s.lastSeq)
+	s.addOutstanding(s.lastSeq)
 
 	s.handleRawPacket(pkt)
 	assert.NotEmpty(t, ch)
-	assert.Empty(t, s.finishReqs)
+	assert.Empty(t, s.errs)
 }
 
-// TestSessionHandleFinishRequest verifies the proper behavior
-// of the handler when we have reached the request limit
-// and received a proper reply
-func TestSessionHandleFinishRequest(t *testing.T) {
+// TestSessionHandleFinish verifies that finishing a session
+// cancels its run and calls the finish handlers
+func TestSessionHandleFinish(t *testing.T) {
 	s, err := NewSession("localhost", DefaultSettings())
 	assert.NoError(t, err)
 	assert.NotNil(t, s)
@@ -218,37 +331,48 @@ func TestSessionHandleFinishRequest(t *testing.T) {
 	}
 
 	s.AddOnFinish(eh)
+	ctx, cancel := context.WithCancel(context.Background())
 	var wg sync.WaitGroup
-	s.handleFinishRequest(nil, &wg)
+	s.handleFinish(cancel, &wg)
 
 	assert.NotEmpty(t, ch)
-	assert.NotEmpty(t, s.finished)
-	assert.NotEmpty(t, s.finishReqs)
+	assert.Error(t, ctx.Err())
 	assert.True(t, s.isFinished)
 }
 
+// TestSessionReportError verifies that only the first reported error is kept
+func TestSessionReportError(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+	assert.NotNil(t, s)
+
+	first := fmt.Errorf("first")
+	s.reportError(first)
+	s.reportError(fmt.Errorf("second"))
+
+	assert.Equal(t, first, <-s.errs)
+	assert.Empty(t, s.errs)
+}
+
 // TestSessionGetDeadlineDuration if the getter for deadline duration is correct
 func TestSessionGetDeadlineDuration(t *testing.T) {
 	s, err := NewSession("localhost", DefaultSettings())
 	assert.NoError(t, err)
 	assert.NotNil(t, s)
 
-	expected := time.Second * time.Duration(s.settings.Deadline)
-	assert.Equal(t, expected, s.getDeadlineDuration())
+	assert.Equal(t, s.settings.Deadline, s.getDeadlineDuration())
 }
 
 // TestSessionGetDeadlineDuration2 if the getter for a custom deadline duration is correct
 func TestSessionGetDeadlineDuration2(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Deadline = 5
+	settings.Deadline = 5 * time.Second
 	settings.IsDeadlineDefault = false
 	s, err := NewSession("localhost", settings)
 	assert.NoError(t, err)
 	assert.NotNil(t, s)
 
-	assert.Equal(t, 5, s.settings.Deadline)
-	expected := time.Second * time.Duration(s.settings.Deadline)
-	assert.Equal(t, expected, s.getDeadlineDuration())
+	assert.Equal(t, 5*time.Second, s.getDeadlineDuration())
 }
 
 // TestSessionGetIntervalDuration if the getter for interval duration is correct
@@ -257,27 +381,24 @@ func TestSessionGetIntervalDuration(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, s)
 
-	expected := time.Duration(float64(time.Second) * s.settings.Interval)
-	assert.Equal(t, expected, s.getIntervalDuration())
+	assert.Equal(t, time.Second, s.getIntervalDuration())
 }
 
 // TestSessionGetIntervalDuration2 if the getter for a custom interval duration is correct
 func TestSessionGetIntervalDuration2(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Interval = 5
+	settings.Interval = 5 * time.Second
 	s, err := NewSession("localhost", settings)
 	assert.NoError(t, err)
 	assert.NotNil(t, s)
 
-	assert.Equal(t, float64(5), s.settings.Interval)
-	expected := time.Duration(float64(time.Second) * s.settings.Interval)
-	assert.Equal(t, expected, s.getIntervalDuration())
+	assert.Equal(t, 5*time.Second, s.getIntervalDuration())
 }
 
 // TestSessionIsDeadlineActive1 checks whether it returns correctly with an active deadline
 func TestSessionIsDeadlineActive1(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Deadline = 5
+	settings.Deadline = 5 * time.Second
 	settings.IsDeadlineDefault = false
 	s, err := NewSession("localhost", settings)
 	assert.NoError(t, err)
@@ -289,7 +410,7 @@ func TestSessionIsDeadlineActive1(t *testing.T) {
 // TestSessionIsDeadlineActive2 checks whether it returns correctly without an active deadline
 func TestSessionIsDeadlineActive2(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Deadline = -1
+	settings.Deadline = 0
 	settings.IsDeadlineDefault = true
 	s, err := NewSession("localhost", settings)
 	assert.NoError(t, err)
@@ -418,7 +539,7 @@ func TestSessionProcessRoundTrip2(t *testing.T) {
 	s.processRoundTrip(rt)
 
 	assert.Equal(t, prevlen, s.Stats.GetTotalRecv())
-	assert.Equal(t, prevtout, s.Stats.GetTotalTimedOut())
+	assert.Equal(t, prevtout+1, s.Stats.GetTotalTimedOut())
 }
 
 // TestSessionProcessRoundTrip3 verifies that the function
@@ -442,5 +563,219 @@ func TestSessionProcessRoundTrip3(t *testing.T) {
 	s.processRoundTrip(rt)
 
 	assert.Equal(t, prevlen, s.Stats.GetTotalRecv())
-	assert.Equal(t, prevttl, s.Stats.GetTotalTTLExpired())
+	assert.Equal(t, prevttl+1, s.Stats.GetTotalTTLExpired())
+}
+
+// TestSessionPreload verifies that the preload burst is sent at once and counted apart from the steady state
+func TestSessionPreload(t *testing.T) {
+	s, conn := fakeSession(t, 7)
+	s.settings.Interval = 50 * time.Millisecond
+	s.settings.Preload = 4
+	conn.drop = func(seq uint64) bool { return seq == 2 || seq == 6 }
+
+	sent := make(chan time.Time, 7)
+	s.AddOnSend(func(s *Session, seq uint64, msg []byte) { sent <- time.Now() })
+
+	assert.NoError(t, s.Run())
+
+	assert.Equal(t, uint32(7), s.Stats.GetTotalSent())
+	assert.Equal(t, uint32(5), s.Stats.GetTotalRecv())
+	assert.Equal(t, uint32(4), s.Stats.GetBurstSent())
+	assert.Equal(t, uint32(3), s.Stats.GetBurstRecv())
+
+	close(sent)
+	var times []time.Time
+	for at := range sent {
+		times = append(times, at)
+	}
+	assert.True(t, times[3].Sub(times[0]) < s.getIntervalDuration(), "the burst must not wait for the interval")
+	assert.True(t, times[4].Sub(times[3]) >= s.getIntervalDuration()/2, "the interval schedule follows the burst")
+}
+
+// TestSessionPreloadCount verifies that the preload burst does not exceed the count
+func TestSessionPreloadCount(t *testing.T) {
+	s, _ := fakeSession(t, 2)
+	s.settings.Preload = 5
+
+	assert.NoError(t, s.Run())
+
+	assert.Equal(t, uint32(2), s.Stats.GetTotalSent())
+	assert.Equal(t, uint32(2), s.Stats.GetBurstSent())
+	assert.Equal(t, uint32(2), s.Stats.GetBurstRecv())
+}
+
+// limitSession creates a session over a fake connection with the given count and deadline, zero meaning unset, and
+// a fixed timeout, whose time only passes as runTimed advances its clock
+func limitSession(t *testing.T, count int, deadline time.Duration) (*Session, *fakeConn) {
+	settings := DefaultSettings()
+	settings.Clock = newTestClock()
+	settings.Interval = 10 * time.Millisecond
+	settings.IsPrivileged = true
+	settings.Timeout = time.Second
+	settings.TimeoutPolicy = TimeoutFixed
+	if count > 0 {
+		settings.MaxCount, settings.IsMaxCountDefault = count, false
+	}
+	if deadline > 0 {
+		settings.Deadline, settings.IsDeadlineDefault = deadline, false
+	}
+
+	s, err := NewSession("localhost", settings)
+	assert.NoError(t, err)
+
+	conn := newFakeConn(true)
+	listenFake(s, conn)
+
+	return s, conn
+}
+
+// runTimed runs the session, advancing its clock in steps of a millisecond whenever the session has had time to
+// handle the previous one, returning how long it took on the clock
+func runTimed(t *testing.T, s *Session) time.Duration {
+	clock := s.settings.Clock.(*ManualClock)
+	start := clock.Monotonic()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Run()
+	}()
+
+	for {
+		select {
+		case err := <-errs:
+			assert.NoError(t, err)
+			return clock.Monotonic() - start
+		case <-time.After(100 * time.Microsecond):
+			clock.Advance(time.Millisecond)
+		}
+	}
+}
+
+// TestSessionLimitCount verifies that with a count and no deadline the session sends count echo requests and waits
+// for each of them to be replied or to time out
+func TestSessionLimitCount(t *testing.T) {
+	s, conn := limitSession(t, 3, 0)
+	s.settings.Timeout = 100 * time.Millisecond
+	conn.drop = func(seq uint64) bool { return seq == 3 }
+
+	elapsed := runTimed(t, s)
+
+	assert.Equal(t, uint32(3), s.Stats.GetTotalSent())
+	assert.Equal(t, uint32(2), s.Stats.GetTotalRecv())
+	assert.Equal(t, uint32(1), s.Stats.GetTotalTimedOut())
+	assert.True(t, elapsed >= 100*time.Millisecond, "must wait for the last request to time out")
+}
+
+// TestSessionLimitCountLinger verifies that the linger setting bounds the wait after the last echo request is sent
+func TestSessionLimitCountLinger(t *testing.T) {
+	s, conn := limitSession(t, 3, 0)
+	s.settings.Timeout = 10 * time.Second
+	s.settings.Linger = 50 * time.Millisecond
+	conn.drop = func(seq uint64) bool { return seq == 3 }
+
+	elapsed := runTimed(t, s)
+
+	assert.Equal(t, uint32(3), s.Stats.GetTotalSent())
+	assert.Equal(t, uint32(2), s.Stats.GetTotalRecv())
+	assert.Equal(t, uint32(1), s.Stats.GetTotalPending())
+	assert.True(t, elapsed < time.Second, "must not wait for the timeout, took %s", elapsed)
+}
+
+// TestSessionLimitCountLingerReplied verifies that lingering ends as soon as every reply is received
+func TestSessionLimitCountLingerReplied(t *testing.T) {
+	s, _ := limitSession(t, 3, 0)
+	s.settings.Linger = time.Hour
+
+	runTimed(t, s)
+
+	assert.Equal(t, uint32(3), s.Stats.GetTotalRecv())
+}
+
+// TestSessionLimitDeadline verifies that with a deadline and no count the session sends until the deadline
+func TestSessionLimitDeadline(t *testing.T) {
+	s, _ := limitSession(t, 0, 100*time.Millisecond)
+
+	elapsed := runTimed(t, s)
+
+	assert.True(t, elapsed >= 100*time.Millisecond)
+	assert.True(t, s.Stats.GetTotalSent() >= 5, "sent %d", s.Stats.GetTotalSent())
+}
+
+// TestSessionLimitCountDeadlineReplied verifies that with both a count and a deadline the session ends once count
+// replies are received
+func TestSessionLimitCountDeadlineReplied(t *testing.T) {
+	s, _ := limitSession(t, 3, time.Hour)
+
+	elapsed := runTimed(t, s)
+
+	assert.Equal(t, uint32(3), s.Stats.GetTotalRecv())
+	assert.True(t, elapsed < time.Second, "must not wait for the deadline, took %s", elapsed)
+}
+
+// TestSessionLimitCountDeadlineLoss verifies that with both a count and a deadline lost replies do not count, so more
+// than count echo requests are sent
+func TestSessionLimitCountDeadlineLoss(t *testing.T) {
+	s, conn := limitSession(t, 3, time.Hour)
+	conn.drop = func(seq uint64) bool { return seq <= 2 }
+
+	runTimed(t, s)
+
+	assert.Equal(t, uint32(3), s.Stats.GetTotalRecv())
+	assert.Equal(t, uint32(5), s.Stats.GetTotalSent())
+}
+
+// TestSessionLimitCountDeadlineExpired verifies that with both a count and a deadline the session ends at the
+// deadline when count replies are not received in time
+func TestSessionLimitCountDeadlineExpired(t *testing.T) {
+	s, conn := limitSession(t, 3, 100*time.Millisecond)
+	conn.drop = func(seq uint64) bool { return true }
+
+	elapsed := runTimed(t, s)
+
+	assert.Zero(t, s.Stats.GetTotalRecv())
+	assert.True(t, s.Stats.GetTotalSent() > 3, "must keep sending after count, sent %d", s.Stats.GetTotalSent())
+	assert.True(t, elapsed >= 100*time.Millisecond)
+}
+
+// TestSessionLimitNone verifies that without a count or a deadline the session runs until it is stopped
+func TestSessionLimitNone(t *testing.T) {
+	s, _ := limitSession(t, 0, 0)
+	clock := s.settings.Clock.(*ManualClock)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Run()
+	}()
+
+	for s.Stats.GetTotalSent() < 5 {
+		select {
+		case <-errs:
+			assert.FailNow(t, "the session must not end by itself")
+		case <-time.After(100 * time.Microsecond):
+			clock.Advance(time.Millisecond)
+		}
+	}
+
+	s.RequestStop()
+	assert.NoError(t, <-errs)
+	assert.True(t, clock.Monotonic() >= 40*time.Millisecond, "sent 5 echo requests in %s", clock.Monotonic())
+}
+
+// TestSessionReachedReplyLimit verifies that the count is a limit of replies only with a deadline
+func TestSessionReachedReplyLimit(t *testing.T) {
+	s, _ := limitSession(t, 2, time.Second)
+	for i := 0; i < 2; i++ {
+		s.Stats.EchoRequested()
+	}
+	assert.False(t, s.reachedRequestLimit())
+	assert.False(t, s.reachedReplyLimit())
+
+	s.Stats.EchoReplied(1)
+	s.Stats.EchoReplied(1)
+	assert.True(t, s.reachedReplyLimit())
+
+	s, _ = limitSession(t, 2, 0)
+	s.Stats.EchoReplied(1)
+	s.Stats.EchoReplied(1)
+	assert.False(t, s.reachedReplyLimit())
 }
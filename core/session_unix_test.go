@@ -0,0 +1,61 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package core
+
+import (
+	"context"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// BenchmarkIdleSession measures the CPU time and the allocations of a session that has nothing to receive,
+// extrapolated to an idle minute. It needs permission to open ICMP sockets and is skipped otherwise.
+func BenchmarkIdleSession(b *testing.B) {
+	const idleWindow = 500 * time.Millisecond
+
+	var cpu time.Duration
+	var allocs uint64
+	for i := 0; i < b.N; i++ {
+		settings := DefaultSettings()
+		settings.Interval = time.Hour // a single echo request is sent, then it stays idle
+
+		s, err := NewSession("localhost", settings)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), idleWindow)
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		cpuBefore := processCPUTime(b)
+
+		err = s.RunContext(ctx)
+		cancel()
+
+		cpu += processCPUTime(b) - cpuBefore
+		runtime.ReadMemStats(&after)
+		allocs += after.Mallocs - before.Mallocs
+
+		if err != context.DeadlineExceeded {
+			b.Skipf("session could not run: %s", err)
+		}
+	}
+
+	idleMinutes := float64(b.N) * float64(idleWindow) / float64(time.Minute)
+	b.ReportMetric(float64(cpu)/float64(time.Millisecond)/idleMinutes, "cpu-ms/idle-min")
+	b.ReportMetric(float64(allocs)/idleMinutes, "allocs/idle-min")
+}
+
+// processCPUTime returns the user and system CPU time consumed by the process so far.
+func processCPUTime(b *testing.B) time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		b.Fatal(err)
+	}
+
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
@@ -5,6 +5,20 @@ import (
 	"time"
 )
 
+const (
+	// minInterval is the minimal interval between two echo requests.
+	minInterval = 10 * time.Millisecond
+
+	// minUnprivilegedInterval is the minimal interval between two echo requests in non-privileged mode.
+	minUnprivilegedInterval = 200 * time.Millisecond
+
+	// maxFlowLabel is the max flow label of IPv6 packets, a 20-bit field.
+	maxFlowLabel = 0xfffff
+
+	// maxPreload is the max amount of echo requests sent in the preload burst, so that their 16-bit seqs are unique.
+	maxPreload = 65536
+)
+
 // Settings contains all configurable properties of a ping session.
 type Settings struct {
 	// TTL is the set IP Time to Live
@@ -19,19 +33,53 @@ type Settings struct {
 	// IsMaxCountDefault contains whether the MaxCount setting is the default
 	IsMaxCountDefault bool
 
-	// Interval is the interval in seconds between a receival and the next send of an ECHO_REQUEST.
-	Interval float64
+	// Interval is the interval between two sends of an ECHO_REQUEST.
+	Interval time.Duration
+
+	// Timeout is the time to wait for a response. Depending on the TimeoutPolicy, it only applies until the round
+	// trip times are known.
+	Timeout time.Duration
 
-	// Timeout is the time in seconds to wait for a response.
-	// The option affects only timeout in absence of any responses, otherwise ping waits for two RTTs.
-	Timeout int
+	// TimeoutPolicy is how the time to wait for each response is computed.
+	TimeoutPolicy TimeoutPolicy
 
-	// Deadline is the time in seconds before ping exits regardless of how many packets have been sent or received.
-	Deadline int
+	// Deadline is the time before ping exits regardless of how many packets have been sent or received.
+	Deadline time.Duration
 
 	// IsDeadlineDefault contains whether the Deadline setting is the default
 	IsDeadlineDefault bool
 
+	// Linger is the max time to wait for the pending replies after the last ECHO_REQUEST is sent, when MaxCount is
+	// set without a Deadline. Zero waits until each of them times out.
+	Linger time.Duration
+
+	// TOS is the type of service of IPv4 echo requests, or their traffic class for IPv6, whose 6 most significant bits
+	// are the DSCP.
+	TOS int
+
+	// FlowLabel is the flow label of IPv6 echo requests, zero for none. Only available on Linux.
+	FlowLabel int
+
+	// PMTUDisc is the path MTU discovery policy of the echo requests. Only available on Linux.
+	PMTUDisc PMTUDisc
+
+	// Mark is the firewall mark of the echo requests, used by policy routing to select a routing table, zero for
+	// none. Only available on Linux.
+	Mark uint32
+
+	// VRF is the name of the VRF device whose routing table is used by the echo requests, empty for the default one.
+	// It can be combined with a source address in Interface. Only available on Linux.
+	VRF string
+
+	// Netns is the name of the network namespace in /var/run/netns, or the path of a network namespace such as
+	// /proc/PID/ns/net, in which the socket is created. Empty uses the namespace of the process. Names are still
+	// resolved in the namespace of the process. Only available on Linux.
+	Netns string
+
+	// Interface is the source IP address or the name of the network interface echo requests are sent from. Empty
+	// lets the system choose them.
+	Interface string
+
 	// IsPrivileged defines if privileged (raw ICMP sockets) or unprivileged (datagram-oriented) mode is used.
 	IsPrivileged bool
 
@@ -40,6 +88,37 @@ type Settings struct {
 
 	// Flood defines whether we should treat as Flood
 	Flood bool
+
+	// Adaptive defines whether the interval adapts to the round trip time, sending an echo request as soon as the
+	// previous one is done but not earlier than the minimal interval allowed, ignoring Interval.
+	Adaptive bool
+
+	// Schedule is the strategy used to space echo requests, whose mean interval is Interval.
+	Schedule Schedule
+
+	// Jitter is the fraction of the interval by which intervals are randomly shortened or lengthened when the
+	// schedule is ScheduleJitter, from 0 to 1.
+	Jitter float64
+
+	// Seed is the seed of the random intervals of the schedule, making them reproducible. Zero uses a random seed.
+	Seed int64
+
+	// Preload is the amount of echo requests sent back-to-back when the session starts sending, before the interval
+	// schedule. Only available in privileged mode.
+	Preload int
+
+	// PayloadSize is the amount of data bytes of the echo requests, at least the bytes the session needs.
+	PayloadSize int
+
+	// EventBuffer is the capacity of the channel returned by Session.Events.
+	EventBuffer int
+
+	// DropEvents defines whether events are dropped when the events channel is full instead of blocking the session.
+	DropEvents bool
+
+	// Clock is the source of time of the session, nil uses the system clock. Replacing it with a ManualClock makes the
+	// session wait for timeouts, intervals and deadlines only as the clock is advanced.
+	Clock Clock
 }
 
 // DefaultSettings returns the default settings for a ping session, change as you wish.
@@ -51,14 +130,32 @@ func DefaultSettings() *Settings {
 		MaxCount:          -1,
 		IsMaxCountDefault: true,
 
-		Deadline:          -1,
+		Deadline:          0,
 		IsDeadlineDefault: true,
+		Linger:            0,
 
-		Timeout:      10,
-		Interval:     1,
-		IsPrivileged: false,
-		LoggingLevel: 0,
-		Flood:        false,
+		Timeout:       10 * time.Second,
+		TimeoutPolicy: TimeoutIPutils,
+		Interval:      time.Second,
+		TOS:           0,
+		FlowLabel:     0,
+		PMTUDisc:      PMTUDiscDefault,
+		Mark:          0,
+		VRF:           "",
+		Netns:         "",
+		Interface:     "",
+		IsPrivileged:  false,
+		LoggingLevel:  0,
+		Flood:         false,
+		Adaptive:      false,
+		Schedule:      ScheduleFixed,
+		Jitter:        0.5,
+		Seed:          0,
+		Preload:       0,
+		PayloadSize:   dataLength,
+		EventBuffer:   64,
+		DropEvents:    false,
+		Clock:         nil,
 	}
 }
 
@@ -72,36 +169,117 @@ func (s *Settings) validate() error {
 	}
 
 	if !s.IsDeadlineDefault && s.Deadline <= 0 {
-		return fmt.Errorf("deadline must be a positive integer")
+		return fmt.Errorf("deadline must be positive")
+	}
+
+	if s.Linger < 0 {
+		return fmt.Errorf("linger must be non-negative")
+	}
+
+	if s.TOS < 0 || s.TOS > 255 {
+		return fmt.Errorf("TOS must be between 0 and 255")
+	}
+
+	if s.FlowLabel < 0 || s.FlowLabel > maxFlowLabel {
+		return fmt.Errorf("flow label must be between 0 and %d", maxFlowLabel)
+	}
+
+	if s.FlowLabel != 0 && !flowLabelSupported {
+		return fmt.Errorf("flow label is not supported on this platform")
+	}
+
+	if s.PMTUDisc < PMTUDiscDefault || s.PMTUDisc > PMTUDiscProbe {
+		return fmt.Errorf("invalid path MTU discovery policy %s", s.PMTUDisc)
+	}
+
+	if s.PMTUDisc != PMTUDiscDefault && !pmtuDiscSupported {
+		return fmt.Errorf("path MTU discovery policy is not supported on this platform")
+	}
+
+	if s.Mark != 0 && !markSupported {
+		return fmt.Errorf("firewall mark is not supported on this platform")
+	}
+
+	if s.VRF != "" && !vrfSupported {
+		return fmt.Errorf("VRF is not supported on this platform")
+	}
+
+	if s.Netns != "" && !netnsSupported {
+		return fmt.Errorf("network namespaces are not supported on this platform")
 	}
 
 	if s.Timeout <= 0 {
-		return fmt.Errorf("timeout must be a positive integer")
+		return fmt.Errorf("timeout must be positive")
+	}
+
+	if s.TimeoutPolicy < TimeoutFixed || s.TimeoutPolicy > TimeoutRFC6298 {
+		return fmt.Errorf("invalid timeout policy %s", s.TimeoutPolicy)
 	}
 
 	if s.Flood && !s.IsPrivileged {
 		return fmt.Errorf("non-privileged mode can not use flood option")
 	}
 
+	if s.Preload < 0 {
+		return fmt.Errorf("preload must be non-negative")
+	}
+
+	if s.Preload > maxPreload {
+		return fmt.Errorf("preload must be at most %d", maxPreload)
+	}
+
+	if s.Preload > 0 && !s.IsPrivileged {
+		return fmt.Errorf("non-privileged mode can not use preload option")
+	}
+
 	if s.Flood && s.IsPrivileged {
-		s.Interval = 0.01
+		s.Interval = minInterval
 	}
 
 	if s.Interval < 0 {
 		return fmt.Errorf("interval must be non-negative")
 	}
 
-	if s.Interval < 0.01 {
-		return fmt.Errorf("interval must be larger than or equal to 0.01s")
+	if s.Interval < minInterval {
+		return fmt.Errorf("interval must be larger than or equal to %s", minInterval)
 	}
 
-	if (s.Interval * float64(time.Second)) >= float64(time.Hour*24*365*10) {
+	if s.Interval >= time.Hour*24*365*10 {
 		return fmt.Errorf("interval must be smaller than 10 years, very arbitrary I know")
 	}
 
-	if s.Interval <= 0.2 && !s.IsPrivileged {
-		return fmt.Errorf("minimal interval allowed for non-privileged mode is 0.2s")
+	if s.Interval < minUnprivilegedInterval && !s.IsPrivileged {
+		return fmt.Errorf("minimal interval allowed for non-privileged mode is %s", minUnprivilegedInterval)
+	}
+
+	if s.Schedule < ScheduleFixed || s.Schedule > SchedulePoisson {
+		return fmt.Errorf("invalid schedule %s", s.Schedule)
+	}
+
+	if s.Jitter < 0 || s.Jitter > 1 {
+		return fmt.Errorf("jitter must be between 0 and 1")
+	}
+
+	if s.PayloadSize < dataLength {
+		return fmt.Errorf("payload size must be at least %d bytes", dataLength)
+	}
+
+	if s.PayloadSize > maxPayloadSize {
+		return fmt.Errorf("payload size must be at most %d bytes", maxPayloadSize)
+	}
+
+	if s.EventBuffer < 0 {
+		return fmt.Errorf("event buffer must be non-negative")
 	}
 
 	return nil
 }
+
+// minIntervalDuration returns the minimal interval allowed between two echo requests.
+func (s *Settings) minIntervalDuration() time.Duration {
+	if s.IsPrivileged {
+		return minInterval
+	}
+
+	return minUnprivilegedInterval
+}
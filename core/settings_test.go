@@ -53,7 +53,7 @@ func TestSettingsPositiveCount(t *testing.T) {
 
 func TestSettingsNegativeDeadline(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Deadline = -1
+	settings.Deadline = -time.Second
 	settings.IsDeadlineDefault = false
 	assert.Error(t, settings.validate())
 }
@@ -67,14 +67,14 @@ func TestSettingsZeroDeadline(t *testing.T) {
 
 func TestSettingsPositiveDeadline(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Deadline = 5
+	settings.Deadline = 5 * time.Second
 	settings.IsDeadlineDefault = false
 	assert.NoError(t, settings.validate())
 }
 
 func TestSettingsNegativeTimeout(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Timeout = -1
+	settings.Timeout = -time.Second
 	assert.Error(t, settings.validate())
 }
 
@@ -86,13 +86,13 @@ func TestSettingsZeroTimeout(t *testing.T) {
 
 func TestSettingsPositiveTimeout(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Timeout = 1
+	settings.Timeout = time.Second
 	assert.NoError(t, settings.validate())
 }
 
 func TestSettingsNegativeInterval(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Interval = -1
+	settings.Interval = -time.Second
 	assert.Error(t, settings.validate())
 }
 
@@ -104,7 +104,7 @@ func TestSettingsZeroInterval(t *testing.T) {
 
 func TestSettingsLargeInterval(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Interval = float64(time.Hour*24*365*10) / float64(time.Second)
+	settings.Interval = time.Hour * 24 * 365 * 10
 	assert.Error(t, settings.validate())
 }
 
@@ -131,26 +131,131 @@ func TestSettingsZeroIntervalPrivileged(t *testing.T) {
 
 func TestSettingsMinIntervalPrivileged(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Interval = 0.01
+	settings.Interval = 10 * time.Millisecond
 	settings.IsPrivileged = true
 	assert.NoError(t, settings.validate())
 }
 
 func TestSettings200msInterval(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Interval = 0.2
+	settings.Interval = 200 * time.Millisecond
+	assert.NoError(t, settings.validate())
+}
+
+func TestSettingsBelow200msInterval(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Interval = 200*time.Millisecond - time.Nanosecond
 	assert.Error(t, settings.validate())
 }
 
 func TestSettings200msIntervalPrivileged(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Interval = 0.2
+	settings.Interval = 200 * time.Millisecond
 	settings.IsPrivileged = true
 	assert.NoError(t, settings.validate())
 }
 
 func TestSettingsPositiveIntegerInterval(t *testing.T) {
 	settings := DefaultSettings()
-	settings.Interval = 1
+	settings.Interval = time.Second
+	assert.NoError(t, settings.validate())
+}
+
+func TestSettingsSmallPayloadSize(t *testing.T) {
+	settings := DefaultSettings()
+	settings.PayloadSize = dataLength - 1
+	assert.Error(t, settings.validate())
+}
+
+func TestSettingsLargePayloadSize(t *testing.T) {
+	settings := DefaultSettings()
+	settings.PayloadSize = maxPayloadSize + 1
+	assert.Error(t, settings.validate())
+}
+
+func TestSettingsPositivePayloadSize(t *testing.T) {
+	settings := DefaultSettings()
+	settings.PayloadSize = 56
+	assert.NoError(t, settings.validate())
+}
+
+func TestSettingsNegativePreload(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Preload = -1
+	settings.IsPrivileged = true
+	assert.Error(t, settings.validate())
+}
+
+func TestSettingsLargePreload(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Preload = maxPreload + 1
+	settings.IsPrivileged = true
+	assert.Error(t, settings.validate())
+}
+
+func TestSettingsPreloadUnprivileged(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Preload = 3
+	assert.Error(t, settings.validate())
+}
+
+func TestSettingsPreloadPrivileged(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Preload = 3
+	settings.IsPrivileged = true
 	assert.NoError(t, settings.validate())
 }
+
+func TestSettingsInvalidSchedule(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Schedule = Schedule(42)
+	assert.Error(t, settings.validate())
+}
+
+func TestSettingsInvalidJitter(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Jitter = 1.5
+	assert.Error(t, settings.validate())
+
+	settings.Jitter = -0.1
+	assert.Error(t, settings.validate())
+}
+
+func TestSettingsInvalidTimeoutPolicy(t *testing.T) {
+	settings := DefaultSettings()
+	settings.TimeoutPolicy = TimeoutPolicy(42)
+	assert.Error(t, settings.validate())
+}
+
+func TestSettingsNegativeLinger(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Linger = -time.Second
+	assert.Error(t, settings.validate())
+}
+
+func TestSettingsInvalidTOS(t *testing.T) {
+	settings := DefaultSettings()
+	settings.TOS = 256
+	assert.Error(t, settings.validate())
+
+	settings.TOS = -1
+	assert.Error(t, settings.validate())
+
+	settings.TOS = 0xb8
+	assert.NoError(t, settings.validate())
+}
+
+func TestSettingsInvalidFlowLabel(t *testing.T) {
+	settings := DefaultSettings()
+	settings.FlowLabel = maxFlowLabel + 1
+	assert.Error(t, settings.validate())
+
+	settings.FlowLabel = -1
+	assert.Error(t, settings.validate())
+}
+
+func TestSettingsInvalidPMTUDisc(t *testing.T) {
+	settings := DefaultSettings()
+	settings.PMTUDisc = PMTUDisc(42)
+	assert.Error(t, settings.validate())
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"math"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,27 +14,38 @@ import (
 type Statistics interface {
 	SessionStarted()        // SessionStarted is supposed to be called when the parent session has started
 	SessionEnded()          // SessionEnded is supposed to be called when the parent session has ended
+	SessionPaused()         // SessionPaused is supposed to be called when the parent session stops sending requests
+	SessionResumed()        // SessionResumed is supposed to be called when the parent session sends requests again
 	EchoRequested()         // EchoRequested is supposed to be called when a new echo request is sent
 	EchoReplied(rtt uint64) // EchoReplied is supposed to be called when a new echo reply has been received
 	EchoTimedOut()          // EchoTimedOut is supposed to be called when an echo request timed out
 	EchoTTLExpired()        // EchoTTLExpired is supposed to be called when an Time Exceeded ICMP message is received
 	EchoRequestError()      // EchoRequestError is supposed to be called when an echo request returns an error
+	EchoMessageTooLong()    // EchoMessageTooLong is supposed to be called when an echo request is too long to be sent
+	BurstEchoRequested()    // BurstEchoRequested is supposed to be called when an echo request of the preload is sent
+	BurstEchoReplied()      // BurstEchoReplied is supposed to be called when an echo request of the preload is replied
 
-	GetStartTime() (time.Time, bool) // GetStartTime returns the start time and whether it has been initialized
-	GetEndTime() (time.Time, bool)   // GetEndTime returns the end time and whether it has been initialized
+	GetStartTime() (time.Time, bool)  // GetStartTime returns the start time and whether it has been initialized
+	GetEndTime() (time.Time, bool)    // GetEndTime returns the end time and whether it has been initialized
+	GetPausedDuration() time.Duration // GetPausedDuration returns the time spent paused, until now or the end time
 
 	GetTotalSent() uint32       // GetTotalSent returns the total number of sent echo requests
 	GetTotalRecv() uint32       // GetTotalRecv returns the total number of received echo replies
 	GetTotalTimedOut() uint32   // GetTotalTimedOut returns the total number of timed out echo requests
 	GetTotalTTLExpired() uint32 // GetTotalTTLExpired returns the total number of echo requests with ttl expired
 	GetTotalErrors() uint32     // GetTotalErrors returns the total number of echo requests that returned an error
+	GetTotalTooLong() uint32    // GetTotalTooLong returns the total number of echo requests too long to be sent
 	GetTotalPending() uint32    // GetTotalPending returns the total number of pending echo requests
 	GetPktLoss() float64        // GetPktLoss returns the packet loss rate
+	GetBurstSent() uint32       // GetBurstSent returns the number of echo requests sent in the preload burst
+	GetBurstRecv() uint32       // GetBurstRecv returns the number of echo replies to the preload burst
 
 	GetRTTMax() uint64  // GetRTTMax returns the max RTT among the ones received via EchoReplied(rtt uint64)
 	GetRTTMin() uint64  // GetRTTMin returns the min RTT among the ones received via EchoReplied(rtt uint64)
 	GetRTTAvg() uint64  // GetRTTAvg returns the average among the RTTs received via EchoReplied(rtt uint64)
 	GetRTTMDev() uint64 // GetRTTMDev returns the mdev among the ones received via EchoReplied(rtt uint64)
+
+	GetRTTPercentile(p float64) uint64 // GetRTTPercentile returns the p-th percentile (0-100] of the received RTTs
 }
 
 // statistics aggregate stats about a session
@@ -54,6 +66,15 @@ type statistics struct {
 	// tiotalError is the total amount of echo requests that returned an error.
 	totalError uint32
 
+	// totalTooLong is the total amount of echo requests that were too long to be sent without fragmentation.
+	totalTooLong uint32
+
+	// burstSent is the amount of echo requests sent in the preload burst, also counted in totalSent.
+	burstSent uint32
+
+	// burstRecv is the amount of echo replies to the preload burst, also counted in TotalRecv.
+	burstRecv uint32
+
 	// rttsMutex controls the append of a rtt into the array
 	rttsMutex sync.RWMutex
 
@@ -75,6 +96,9 @@ type statistics struct {
 	// timeMutex controls updates to the times
 	timeMutex sync.RWMutex
 
+	// clock is where the times are read from
+	clock Clock
+
 	// stTime contains the start time of the session
 	stTime time.Time
 
@@ -86,6 +110,15 @@ type statistics struct {
 
 	// ended indicates whether the endTime has been initialized
 	ended bool
+
+	// pausedAt contains the start time of the current pause
+	pausedAt time.Time
+
+	// paused indicates whether the session is paused
+	paused bool
+
+	// pausedTotal contains the duration of all finished pauses
+	pausedTotal time.Duration
 }
 
 // SessionStarted is supposed to be called when the parent session has started
@@ -93,7 +126,7 @@ func (s *statistics) SessionStarted() {
 	s.timeMutex.Lock()
 	defer s.timeMutex.Unlock()
 
-	s.stTime = time.Now()
+	s.stTime = s.clock.Now()
 	s.started = true
 }
 
@@ -102,8 +135,35 @@ func (s *statistics) SessionEnded() {
 	s.timeMutex.Lock()
 	defer s.timeMutex.Unlock()
 
-	s.endTime = time.Now()
+	s.endTime = s.clock.Now()
 	s.ended = true
+
+	if s.paused {
+		s.pausedTotal += s.endTime.Sub(s.pausedAt)
+		s.paused = false
+	}
+}
+
+// SessionPaused is supposed to be called when the parent session stops sending requests
+func (s *statistics) SessionPaused() {
+	s.timeMutex.Lock()
+	defer s.timeMutex.Unlock()
+
+	if !s.paused && !s.ended {
+		s.pausedAt = s.clock.Now()
+		s.paused = true
+	}
+}
+
+// SessionResumed is supposed to be called when the parent session sends requests again
+func (s *statistics) SessionResumed() {
+	s.timeMutex.Lock()
+	defer s.timeMutex.Unlock()
+
+	if s.paused {
+		s.pausedTotal += s.clock.Now().Sub(s.pausedAt)
+		s.paused = false
+	}
 }
 
 // EchoRequested is supposed to be called when a new echo request is sent
@@ -140,6 +200,21 @@ func (s *statistics) EchoRequestError() {
 	atomic.AddUint32(&s.totalError, 1)
 }
 
+// EchoMessageTooLong is supposed to be called when an echo request is too long to be sent
+func (s *statistics) EchoMessageTooLong() {
+	atomic.AddUint32(&s.totalTooLong, 1)
+}
+
+// BurstEchoRequested is supposed to be called when an echo request of the preload is sent
+func (s *statistics) BurstEchoRequested() {
+	atomic.AddUint32(&s.burstSent, 1)
+}
+
+// BurstEchoReplied is supposed to be called when an echo request of the preload is replied
+func (s *statistics) BurstEchoReplied() {
+	atomic.AddUint32(&s.burstRecv, 1)
+}
+
 // GetStartTime returns the start time and whether it has been initialized
 func (s *statistics) GetStartTime() (time.Time, bool) {
 	s.timeMutex.RLock()
@@ -156,6 +231,18 @@ func (s *statistics) GetEndTime() (time.Time, bool) {
 	return s.endTime, s.ended
 }
 
+// GetPausedDuration returns the time spent paused, until now or the end time
+func (s *statistics) GetPausedDuration() time.Duration {
+	s.timeMutex.RLock()
+	defer s.timeMutex.RUnlock()
+
+	if s.paused {
+		return s.pausedTotal + s.clock.Now().Sub(s.pausedAt)
+	}
+
+	return s.pausedTotal
+}
+
 // GetTotalSent returns the total number of sent echo requests
 func (s *statistics) GetTotalSent() uint32 {
 	return atomic.LoadUint32(&s.totalSent)
@@ -181,9 +268,15 @@ func (s *statistics) GetTotalErrors() uint32 {
 	return atomic.LoadUint32(&s.totalError)
 }
 
+// GetTotalTooLong returns the total number of echo requests too long to be sent
+func (s *statistics) GetTotalTooLong() uint32 {
+	return atomic.LoadUint32(&s.totalTooLong)
+}
+
 // GetTotalPending returns the total number of pending echo requests
 func (s *statistics) GetTotalPending() uint32 {
-	return s.GetTotalSent() - s.GetTotalRecv() - s.GetTotalTimedOut() - s.GetTotalTTLExpired() - s.GetTotalErrors()
+	return s.GetTotalSent() - s.GetTotalRecv() - s.GetTotalTimedOut() - s.GetTotalTTLExpired() - s.GetTotalErrors() -
+		s.GetTotalTooLong()
 }
 
 // GetPktLoss returns the packet loss rate
@@ -195,6 +288,16 @@ func (s *statistics) GetPktLoss() float64 {
 	return float64(1) - (float64(s.GetTotalRecv()) / float64(s.GetTotalSent()))
 }
 
+// GetBurstSent returns the number of echo requests sent in the preload burst
+func (s *statistics) GetBurstSent() uint32 {
+	return atomic.LoadUint32(&s.burstSent)
+}
+
+// GetBurstRecv returns the number of echo replies to the preload burst
+func (s *statistics) GetBurstRecv() uint32 {
+	return atomic.LoadUint32(&s.burstRecv)
+}
+
 // GetRTTMax returns the max RTT among the ones received via EchoReplied(rtt uint64)
 func (s *statistics) GetRTTMax() uint64 {
 	s.rttsMutex.RLock()
@@ -236,15 +339,48 @@ func (s *statistics) GetRTTMDev() uint64 {
 	return uint64(math.Sqrt(sqrd))
 }
 
+// GetRTTPercentile returns the p-th percentile (0-100] of the RTTs received via EchoReplied(rtt uint64),
+// using the nearest-rank method.
+func (s *statistics) GetRTTPercentile(p float64) uint64 {
+	s.rttsMutex.RLock()
+	sorted := append([]uint64(nil), s.rtts...)
+	s.rttsMutex.RUnlock()
+
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+
+	return sorted[rank-1]
+}
+
 // NewStatistics creates and initializes a Statistics struct.
 func NewStatistics() Statistics {
+	return newStatistics(SystemClock{})
+}
+
+// newStatistics creates and initializes a Statistics struct whose times are read from clock.
+func newStatistics(clock Clock) Statistics {
 	return &statistics{
+		clock:           clock,
 		rtts:            []uint64{},
 		totalSent:       0,
 		TotalRecv:       0,
 		totalTimedOut:   0,
 		totalTTLExpired: 0,
 		totalError:      0,
+		totalTooLong:    0,
+		burstSent:       0,
+		burstRecv:       0,
 		rttsMax:         0,
 		rttsMin:         math.MaxInt64,
 		rttsSum:         0,
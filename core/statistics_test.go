@@ -82,3 +82,63 @@ func TestFinishInitStatsCb(t *testing.T) {
 	assert.Equal(t, mdev, s.Stats.GetRTTMDev())
 	assert.Equal(t, loss, s.Stats.GetPktLoss())
 }
+
+// TestRTTPercentile tests if percentiles follow the nearest-rank method
+func TestRTTPercentile(t *testing.T) {
+	stats := NewStatistics()
+	assert.Zero(t, stats.GetRTTPercentile(99))
+
+	// added out of order on purpose
+	for i := 100; i >= 1; i-- {
+		stats.EchoReplied(uint64(i))
+	}
+
+	assert.Equal(t, uint64(1), stats.GetRTTPercentile(0))
+	assert.Equal(t, uint64(1), stats.GetRTTPercentile(1))
+	assert.Equal(t, uint64(50), stats.GetRTTPercentile(50))
+	assert.Equal(t, uint64(99), stats.GetRTTPercentile(99))
+	assert.Equal(t, uint64(100), stats.GetRTTPercentile(99.5))
+	assert.Equal(t, uint64(100), stats.GetRTTPercentile(100))
+}
+
+// TestPausedDuration tests if the time spent paused is accumulated across pauses and stops at the end time
+func TestPausedDuration(t *testing.T) {
+	clock := newTestClock()
+	stats := newStatistics(clock)
+	stats.SessionStarted()
+	assert.Zero(t, stats.GetPausedDuration())
+
+	stats.SessionPaused()
+	clock.Advance(10 * time.Millisecond)
+	assert.Equal(t, 10*time.Millisecond, stats.GetPausedDuration(), "the current pause is accumulated")
+	stats.SessionResumed()
+	assert.Equal(t, 10*time.Millisecond, stats.GetPausedDuration())
+
+	clock.Advance(10 * time.Millisecond)
+	assert.Equal(t, 10*time.Millisecond, stats.GetPausedDuration(), "time not paused must not be accumulated")
+
+	stats.SessionPaused()
+	stats.SessionPaused()
+	clock.Advance(10 * time.Millisecond)
+	stats.SessionEnded()
+	assert.Equal(t, 20*time.Millisecond, stats.GetPausedDuration())
+
+	clock.Advance(10 * time.Millisecond)
+	assert.Equal(t, 20*time.Millisecond, stats.GetPausedDuration(), "a pause ends with the session")
+
+	start, _ := stats.GetStartTime()
+	end, _ := stats.GetEndTime()
+	assert.Equal(t, 30*time.Millisecond, end.Sub(start))
+}
+
+// TestBurstCounters tests if the preload burst is counted apart from, and as part of, the totals
+func TestBurstCounters(t *testing.T) {
+	stats := NewStatistics()
+	stats.BurstEchoRequested()
+	stats.BurstEchoRequested()
+	stats.BurstEchoReplied()
+
+	assert.Equal(t, uint32(2), stats.GetBurstSent())
+	assert.Equal(t, uint32(1), stats.GetBurstRecv())
+	assert.Zero(t, stats.GetTotalSent(), "the session counts every echo request in the totals")
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeoutPolicy is how the time to wait for the reply of each echo request is computed.
+type TimeoutPolicy int
+
+const (
+	// TimeoutFixed always waits for the Timeout setting.
+	TimeoutFixed TimeoutPolicy = iota
+	// TimeoutIPutils waits for the Timeout setting until a reply is received, then for twice the largest round trip
+	// time, as iputils ping does.
+	TimeoutIPutils
+	// TimeoutRFC6298 waits for the Timeout setting until a reply is received, then for the smoothed round trip time
+	// plus four times its variation, as the retransmission timeout of RFC 6298, so that outliers fade away. As in RFC
+	// 6298, it waits for at least a second.
+	TimeoutRFC6298
+)
+
+const (
+	// rttAlpha is the gain of the smoothed round trip time, from RFC 6298.
+	rttAlpha = 1.0 / 8
+
+	// rttBeta is the gain of the round trip time variation, from RFC 6298.
+	rttBeta = 1.0 / 4
+
+	// rttGranularity is the smallest variation considered by the RFC 6298 timeout, the clock granularity G.
+	rttGranularity = time.Millisecond
+
+	// rttMinRTO is the lower bound of the RFC 6298 timeout, so that replies delayed by a hiccup of a fast link are not
+	// taken for lost.
+	rttMinRTO = time.Second
+)
+
+// timeoutPolicies are all valid timeout policies, indexed by their value.
+var timeoutPolicies = []string{"fixed", "iputils", "rfc6298"}
+
+// String returns the name of the timeout policy.
+func (p TimeoutPolicy) String() string {
+	if p < 0 || int(p) >= len(timeoutPolicies) {
+		return fmt.Sprintf("TimeoutPolicy(%d)", int(p))
+	}
+
+	return timeoutPolicies[p]
+}
+
+// ParseTimeoutPolicy returns the timeout policy with the given name.
+func ParseTimeoutPolicy(name string) (TimeoutPolicy, error) {
+	for i, val := range timeoutPolicies {
+		if val == name {
+			return TimeoutPolicy(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid timeout policy %q, must be one of %s", name,
+		strings.Join(timeoutPolicies, ", "))
+}
+
+// rttEstimator keeps the smoothed round trip time and its variation as described in RFC 6298, along with the largest
+// round trip time.
+type rttEstimator struct {
+	mutex  sync.Mutex
+	srtt   time.Duration
+	rttvar time.Duration
+	max    time.Duration
+	ok     bool
+}
+
+// update adds a round trip time measurement.
+func (e *rttEstimator) update(rtt time.Duration) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if rtt > e.max {
+		e.max = rtt
+	}
+
+	if !e.ok {
+		e.srtt = rtt
+		e.rttvar = rtt / 2
+		e.ok = true
+		return
+	}
+
+	delta := e.srtt - rtt
+	if delta < 0 {
+		delta = -delta
+	}
+
+	e.rttvar = time.Duration((1-rttBeta)*float64(e.rttvar) + rttBeta*float64(delta))
+	e.srtt = time.Duration((1-rttAlpha)*float64(e.srtt) + rttAlpha*float64(rtt))
+}
+
+// rto returns the timeout given by the measurements, at least rttMinRTO, and whether there has been any.
+func (e *rttEstimator) rto() (time.Duration, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	variation := 4 * e.rttvar
+	if variation < rttGranularity {
+		variation = rttGranularity
+	}
+
+	rto := e.srtt + variation
+	if rto < rttMinRTO {
+		rto = rttMinRTO
+	}
+
+	return rto, e.ok
+}
+
+// maxRTT returns the largest round trip time measured and whether there has been any.
+func (e *rttEstimator) maxRTT() (time.Duration, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.max, e.ok
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTimeoutPolicyString verifies the names of the timeout policies and that they are parsed back
+func TestTimeoutPolicyString(t *testing.T) {
+	for _, p := range []TimeoutPolicy{TimeoutFixed, TimeoutIPutils, TimeoutRFC6298} {
+		parsed, err := ParseTimeoutPolicy(p.String())
+		assert.NoError(t, err)
+		assert.Equal(t, p, parsed)
+	}
+
+	assert.Equal(t, "TimeoutPolicy(42)", TimeoutPolicy(42).String())
+
+	_, err := ParseTimeoutPolicy("forever")
+	assert.Error(t, err)
+}
+
+// TestRTTEstimator verifies the smoothed round trip time and its variation against RFC 6298
+func TestRTTEstimator(t *testing.T) {
+	var e rttEstimator
+	_, ok := e.rto()
+	assert.False(t, ok)
+
+	e.update(time.Second)
+	rto, ok := e.rto()
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, rto)
+
+	// RTTVAR = 3/4 * 500ms + 1/4 * |1s - 200ms| and SRTT = 7/8 * 1s + 1/8 * 200ms
+	e.update(200 * time.Millisecond)
+	rto, _ = e.rto()
+	assert.Equal(t, 900*time.Millisecond+4*575*time.Millisecond, rto)
+
+	var stable rttEstimator
+	for i := 0; i < 200; i++ {
+		stable.update(2 * time.Second)
+	}
+	rto, _ = stable.rto()
+	assert.Equal(t, 2*time.Second+rttGranularity, rto, "the variation is at least the granularity")
+}
+
+// TestRTTEstimatorMinRTO verifies that the timeout of a fast link is kept at the lower bound of RFC 6298
+func TestRTTEstimatorMinRTO(t *testing.T) {
+	var e rttEstimator
+	for i := 0; i < 100; i++ {
+		e.update(time.Duration(50+i%3*50) * time.Microsecond)
+	}
+
+	rto, ok := e.rto()
+	assert.True(t, ok)
+	assert.Equal(t, rttMinRTO, rto)
+
+	s := timeoutSession(t, TimeoutRFC6298, 100*time.Microsecond, 80*time.Microsecond, 120*time.Microsecond)
+	assert.Equal(t, time.Second, s.getTimeoutDuration())
+}
+
+// timeoutSession creates a session with the given timeout policy that has received the given round trip times
+func timeoutSession(t *testing.T, policy TimeoutPolicy, rtts ...time.Duration) *Session {
+	settings := DefaultSettings()
+	settings.Timeout = 5 * time.Second
+	settings.TimeoutPolicy = policy
+
+	s, err := NewSession("localhost", settings)
+	assert.NoError(t, err)
+
+	for _, rtt := range rtts {
+		s.Stats.EchoRequested()
+		s.processRoundTrip(&RoundTrip{Res: Replied, Time: rtt})
+	}
+
+	return s
+}
+
+// TestGetTimeoutDurationPolicies verifies the timeout of each policy before and after replies, including one outlier
+func TestGetTimeoutDurationPolicies(t *testing.T) {
+	rtts := []time.Duration{3 * time.Second}
+	for i := 0; i < 50; i++ {
+		rtts = append(rtts, 100*time.Millisecond)
+	}
+
+	for _, p := range []TimeoutPolicy{TimeoutFixed, TimeoutIPutils, TimeoutRFC6298} {
+		assert.Equal(t, 5*time.Second, timeoutSession(t, p).getTimeoutDuration(), "%s before replies", p)
+	}
+
+	assert.Equal(t, 5*time.Second, timeoutSession(t, TimeoutFixed, rtts...).getTimeoutDuration())
+	assert.Equal(t, 6*time.Second, timeoutSession(t, TimeoutIPutils, rtts...).getTimeoutDuration(),
+		"the outlier keeps inflating the timeout")
+
+	rto := timeoutSession(t, TimeoutRFC6298, rtts...).getTimeoutDuration()
+	assert.Equal(t, rttMinRTO, rto, "the outlier must fade away down to the lower bound")
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxClockDivergence is how much the rtt measured from the time carried in the payload may differ from the one
+// measured on the monotonic clock before the wall clock is considered to have stepped during the round trip.
+const maxClockDivergence = 10 * time.Millisecond
+
+// ClockSource is where the send and receive times a round trip time is measured with come from.
+type ClockSource int
+
+const (
+	// ClockUser is when both times are taken by the session, right before writing the echo request and right after
+	// reading its reply.
+	ClockUser ClockSource = iota
+	// ClockKernelRecv is when the receive time is stamped by the kernel as the reply arrives, while the send time is
+	// taken by the session.
+	ClockKernelRecv
+	// ClockKernel is when both times are stamped by the kernel, as the echo request leaves and as the reply arrives.
+	ClockKernel
+)
+
+// clockSources are the names of all clock sources, indexed by their value.
+var clockSources = []string{"user", "kernel-rx", "kernel"}
+
+// String returns the name of the clock source.
+func (c ClockSource) String() string {
+	if c < 0 || int(c) >= len(clockSources) {
+		return fmt.Sprintf("ClockSource(%d)", int(c))
+	}
+
+	return clockSources[c]
+}
+
+// sendTimestamper is implemented by the connections that know when the kernel sent the packets written to them.
+type sendTimestamper interface {
+	// lastSent returns the time the kernel sent the last packet written, false if it is unknown. It must be called
+	// once after every packet successfully written.
+	lastSent() (time.Time, bool)
+}
+
+// measureRoundTrip sets the rtt of a round trip whose request the session sent at sent and the kernel at
+// kernelSentAt, zero if unknown. The rtt is measured on the monotonic clock unless kernel timestamps are known, as they
+// are more accurate. Kernel timestamps are read from the wall clock, they are only used if the time carried in the
+// payload shows that the wall clock did not step during the round trip.
+func measureRoundTrip(rt *RoundTrip, sent instant, kernelSentAt time.Time) {
+	rt.Sent = sent.wall
+	if rt.Res != Replied {
+		return
+	}
+
+	monotonic := rt.readAt.sub(sent)
+	rt.userTime = monotonic
+	if !rt.PayloadSent.IsZero() {
+		divergence := rt.readAt.wall.Round(0).Sub(rt.PayloadSent) - monotonic
+		rt.ClockDiverged = divergence > maxClockDivergence || divergence < -maxClockDivergence
+	}
+
+	if rt.Clock == ClockKernelRecv && !rt.ClockDiverged {
+		from, clock := sent.wall, ClockKernelRecv
+		if !kernelSentAt.IsZero() {
+			from, clock = kernelSentAt, ClockKernel
+		}
+
+		// the kernel stamps the packets between the times the session takes
+		if rtt := rt.Recv.Round(0).Sub(from.Round(0)); rtt >= 0 && rtt <= monotonic+maxClockDivergence {
+			rt.Sent, rt.Time, rt.Clock = from, rtt, clock
+			return
+		}
+	}
+
+	rt.Recv, rt.Time, rt.Clock = rt.readAt.wall, monotonic, ClockUser
+}
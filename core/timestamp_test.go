@@ -0,0 +1,203 @@
+package core
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stampedConn is a fakeConn whose kernel stamps the packets with fixed times
+type stampedConn struct {
+	*fakeConn
+
+	// sent is the time every packet is sent at, zero if unknown
+	sent time.Time
+
+	// recv is the time every packet is received at, zero if unknown
+	recv time.Time
+}
+
+func (c *stampedConn) ReadFrom(b []byte) (int, *controlMessage, error) {
+	length, cm, err := c.fakeConn.ReadFrom(b)
+	if cm != nil {
+		cm.Timestamp = c.recv
+	}
+	return length, cm, err
+}
+
+func (c *stampedConn) lastSent() (time.Time, bool) {
+	return c.sent, !c.sent.IsZero()
+}
+
+// clockedRoundTrip sends a single echo request over conn with the session reading the time from clock, which is moved
+// by between before the reply is read, and returns its round trip
+func clockedRoundTrip(t *testing.T, conn packetConn, clock *ManualClock, between func()) *RoundTrip {
+	settings := DefaultSettings()
+	settings.Clock = clock
+	s, err := NewSession("localhost", settings)
+	assert.NoError(t, err)
+	s.isIPv4 = true
+	s.addr = &net.IPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+	var rts []*RoundTrip
+	s.AddOnRecv(func(_ *Session, rt *RoundTrip) {
+		rts = append(rts, rt)
+	})
+
+	s.handleIntervalTimer(context.Background(), conn)
+	between()
+
+	buffer := make([]byte, readBufferSize)
+	length, cm, err := conn.ReadFrom(buffer)
+	assert.NoError(t, err)
+	s.handleRawPacket(&rawPacket{content: buffer, length: length, cm: cm, readAt: s.now()})
+	s.reqW.Wait()
+
+	if !assert.Len(t, rts, 1) {
+		t.FailNow()
+	}
+
+	return rts[0]
+}
+
+// TestClockSourceString tests if every clock source has a name
+func TestClockSourceString(t *testing.T) {
+	assert.Equal(t, "user", ClockUser.String())
+	assert.Equal(t, "kernel-rx", ClockKernelRecv.String())
+	assert.Equal(t, "kernel", ClockKernel.String())
+	assert.Equal(t, "ClockSource(9)", ClockSource(9).String())
+}
+
+// TestSessionClockUser verifies that the session measures the rtt on the monotonic clock without kernel timestamps,
+// even if the kernel stamps the packets sent
+func TestSessionClockUser(t *testing.T) {
+	clock := newTestClock()
+	sent := clock.Now()
+	rt := clockedRoundTrip(t, &stampedConn{fakeConn: newFakeConn(true), sent: sent}, clock, func() {
+		clock.Advance(2 * time.Millisecond)
+	})
+
+	assert.Equal(t, ClockUser, rt.Clock)
+	assert.Equal(t, 2*time.Millisecond, rt.Time)
+	assert.Equal(t, sent, rt.Sent)
+	assert.Equal(t, sent.Add(2*time.Millisecond), rt.Recv)
+	assert.Equal(t, sent, rt.PayloadSent)
+	assert.False(t, rt.ClockDiverged)
+}
+
+// TestSessionClockStepped verifies that a step of the wall clock during the round trip neither changes the rtt nor
+// goes unnoticed
+func TestSessionClockStepped(t *testing.T) {
+	for _, step := range []time.Duration{-time.Hour, time.Hour, -20 * time.Millisecond} {
+		clock := newTestClock()
+		rt := clockedRoundTrip(t, newFakeConn(true), clock, func() {
+			clock.Advance(time.Millisecond)
+			clock.Step(step)
+			clock.Advance(time.Millisecond)
+		})
+
+		assert.Equal(t, 2*time.Millisecond, rt.Time, "step of %s", step)
+		assert.True(t, rt.ClockDiverged, "step of %s", step)
+	}
+}
+
+// TestSessionClockKernel verifies that the rtt is measured between the kernel timestamps when both are known
+func TestSessionClockKernel(t *testing.T) {
+	clock := newTestClock()
+	start := clock.Now()
+	conn := &stampedConn{
+		fakeConn: newFakeConn(true),
+		sent:     start.Add(100 * time.Microsecond),
+		recv:     start.Add(1600 * time.Microsecond),
+	}
+	rt := clockedRoundTrip(t, conn, clock, func() {
+		clock.Advance(2 * time.Millisecond)
+	})
+
+	assert.Equal(t, ClockKernel, rt.Clock)
+	assert.Equal(t, 1500*time.Microsecond, rt.Time)
+	assert.Equal(t, conn.sent, rt.Sent)
+	assert.Equal(t, conn.recv, rt.Recv)
+}
+
+// TestSessionClockKernelRecv verifies that the kernel receive time is used along with the time the session sent the
+// echo request when the kernel does not stamp the packets sent
+func TestSessionClockKernelRecv(t *testing.T) {
+	clock := newTestClock()
+	start := clock.Now()
+	conn := &stampedConn{fakeConn: newFakeConn(true), recv: start.Add(1500 * time.Microsecond)}
+	rt := clockedRoundTrip(t, conn, clock, func() {
+		clock.Advance(2 * time.Millisecond)
+	})
+
+	assert.Equal(t, ClockKernelRecv, rt.Clock)
+	assert.Equal(t, 1500*time.Microsecond, rt.Time)
+	assert.Equal(t, start, rt.Sent)
+	assert.Equal(t, conn.recv, rt.Recv)
+}
+
+// TestSessionClockKernelStepped verifies that kernel timestamps are not used if the wall clock they are read from
+// stepped during the round trip or if they are not within the times the session took
+func TestSessionClockKernelStepped(t *testing.T) {
+	clock := newTestClock()
+	start := clock.Now()
+	rt := clockedRoundTrip(t, &stampedConn{
+		fakeConn: newFakeConn(true),
+		sent:     start,
+		recv:     start.Add(-time.Hour),
+	}, clock, func() {
+		clock.Step(-time.Hour)
+		clock.Advance(2 * time.Millisecond)
+	})
+
+	assert.Equal(t, ClockUser, rt.Clock)
+	assert.Equal(t, 2*time.Millisecond, rt.Time)
+	assert.True(t, rt.ClockDiverged)
+
+	clock = newTestClock()
+	start = clock.Now()
+	rt = clockedRoundTrip(t, &stampedConn{
+		fakeConn: newFakeConn(true),
+		sent:     start,
+		recv:     start.Add(time.Second),
+	}, clock, func() {
+		clock.Advance(2 * time.Millisecond)
+	})
+
+	assert.Equal(t, ClockUser, rt.Clock)
+	assert.Equal(t, 2*time.Millisecond, rt.Time)
+	assert.False(t, rt.ClockDiverged)
+}
+
+// TestTimeoutKernelRoundTrip verifies that timeouts are computed from the rtt the session measures itself when kernel
+// timestamps leave out how long replies wait to be read, as the session waits for the timeouts itself
+func TestTimeoutKernelRoundTrip(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	sent := instant{wall: start, mono: time.Second}
+	kernelRT := func() *RoundTrip {
+		rt := &RoundTrip{
+			Res:    Replied,
+			Clock:  ClockKernelRecv,
+			Recv:   start.Add(100 * time.Microsecond),
+			readAt: instant{wall: start.Add(20 * time.Millisecond), mono: time.Second + 20*time.Millisecond},
+		}
+		measureRoundTrip(rt, sent, start.Add(50*time.Microsecond))
+		return rt
+	}
+
+	rt := kernelRT()
+	assert.Equal(t, ClockKernel, rt.Clock)
+	assert.Equal(t, 50*time.Microsecond, rt.Time)
+
+	s := timeoutSession(t, TimeoutIPutils)
+	s.processRoundTrip(kernelRT())
+	assert.Equal(t, 40*time.Millisecond, s.getTimeoutDuration())
+	assert.Equal(t, uint64(50*time.Microsecond), s.Stats.GetRTTMax(), "the statistics keep the kernel rtt")
+
+	s = timeoutSession(t, TimeoutRFC6298)
+	s.processRoundTrip(kernelRT())
+	assert.True(t, s.getTimeoutDuration() > 20*time.Millisecond, "got %s", s.getTimeoutDuration())
+}
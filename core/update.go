@@ -0,0 +1,183 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// SettingsPatch contains the settings that can be changed while a session runs, nil fields are left unchanged.
+type SettingsPatch struct {
+	// Interval is the new interval between two echo requests, it disables flood.
+	Interval *time.Duration
+
+	// Timeout is the new time to wait for a response.
+	Timeout *time.Duration
+
+	// TTL is the new IP Time to Live.
+	TTL *int
+
+	// PayloadSize is the new amount of data bytes of the echo requests.
+	PayloadSize *int
+}
+
+// merge sets every field of o that is not nil in p.
+func (p *SettingsPatch) merge(o SettingsPatch) {
+	if o.Interval != nil {
+		p.Interval = o.Interval
+	}
+	if o.Timeout != nil {
+		p.Timeout = o.Timeout
+	}
+	if o.TTL != nil {
+		p.TTL = o.TTL
+	}
+	if o.PayloadSize != nil {
+		p.PayloadSize = o.PayloadSize
+	}
+}
+
+// apply changes settings according to the patch.
+func (p *SettingsPatch) apply(settings *Settings) {
+	if p.Interval != nil {
+		settings.Interval = *p.Interval
+		settings.Flood = false
+	}
+	if p.Timeout != nil {
+		settings.Timeout = *p.Timeout
+	}
+	if p.TTL != nil {
+		settings.TTL = *p.TTL
+		settings.IsTTLDefault = false
+	}
+	if p.PayloadSize != nil {
+		settings.PayloadSize = *p.PayloadSize
+	}
+}
+
+// Update changes the settings of the session according to patch, it is safe to call it at any moment.
+// The patch is validated against the session settings and, on a running session, takes effect from the next echo
+// request on, restarting the interval between requests if it changed. Statistics are kept.
+func (s *Session) Update(patch SettingsPatch) error {
+	s.reqMutex.Lock()
+	defer s.reqMutex.Unlock()
+
+	pending := s.pendingPatch
+	pending.merge(patch)
+
+	updated := *s.settings
+	pending.apply(&updated)
+	if err := updated.validate(); err != nil {
+		return fmt.Errorf("invalid settings: %w", err)
+	}
+
+	s.pendingPatch = pending
+
+	select {
+	case s.updateReqs <- struct{}{}:
+	default:
+		// an update is already pending and will include this patch
+	}
+
+	s.logger.Info("Requested to update the session settings")
+	return nil
+}
+
+// SetInterval requests a change of the interval between two echo requests, see Update.
+func (s *Session) SetInterval(interval time.Duration) error {
+	return s.Update(SettingsPatch{Interval: &interval})
+}
+
+// handleUpdateRequest is responsible for applying the pending settings patch, returning the scheduler to be used from
+// now on. The connection and the scheduler are nil if they have not been created yet.
+func (s *Session) handleUpdateRequest(conn packetConn, sched scheduler) (scheduler, error) {
+	s.reqMutex.Lock()
+	patch := s.pendingPatch
+	s.pendingPatch = SettingsPatch{}
+	patch.apply(s.settings)
+	s.reqMutex.Unlock()
+
+	if patch.TTL != nil && conn != nil {
+		s.logger.Infof("Changing TTL to %d", *patch.TTL)
+		if err := conn.SetTTL(*patch.TTL); err != nil {
+			return sched, fmt.Errorf("could not set TTL in connection, error: %w", err)
+		}
+	}
+
+	if patch.Interval != nil && sched != nil {
+		s.logger.Infof("Changing interval to duration %s", s.getIntervalDuration())
+		sched.Stop()
+		sched = s.newScheduler(s.outstandingCount())
+	}
+
+	return sched, nil
+}
+
+// Pause stops sending echo requests until Resume is called, it is safe to call it at any moment.
+// The connection, the pending echo requests and the statistics are kept, and the time spent paused is reported by
+// the statistics.
+func (s *Session) Pause() error {
+	return s.requestPause(true)
+}
+
+// Resume sends echo requests again after Pause, starting a new interval.
+func (s *Session) Resume() error {
+	return s.requestPause(false)
+}
+
+// IsPaused returns whether sending echo requests has been paused.
+func (s *Session) IsPaused() bool {
+	s.reqMutex.Lock()
+	defer s.reqMutex.Unlock()
+
+	return s.pauseRequested
+}
+
+// requestPause requests sending echo requests to be paused or resumed.
+func (s *Session) requestPause(pause bool) error {
+	s.reqMutex.Lock()
+	defer s.reqMutex.Unlock()
+
+	if s.pauseRequested == pause {
+		if pause {
+			return fmt.Errorf("the session is already paused")
+		}
+		return fmt.Errorf("the session is not paused")
+	}
+	s.pauseRequested = pause
+
+	select {
+	case s.pauseReqs <- struct{}{}:
+	default:
+		// a change is already pending and will read the latest request
+	}
+
+	return nil
+}
+
+// handlePauseRequest is responsible for pausing or resuming the session as requested, given whether it is paused. It
+// returns whether the session is paused from now on and the scheduler to be used.
+func (s *Session) handlePauseRequest(paused bool, sched scheduler) (bool, scheduler) {
+	s.reqMutex.Lock()
+	requested := s.pauseRequested
+	s.reqMutex.Unlock()
+
+	if requested == paused {
+		return paused, sched
+	}
+
+	sched.Stop()
+
+	if requested {
+		s.logger.Info("Pausing the session")
+		s.Stats.SessionPaused()
+		s.notify(func(o Observer) { o.OnPause(s) })
+		s.emit(Event{Type: EventPaused})
+		return true, sched
+	}
+
+	s.logger.Info("Resuming the session")
+	s.Stats.SessionResumed()
+	s.notify(func(o Observer) { o.OnResume(s) })
+	s.emit(Event{Type: EventResumed})
+	return false, s.newScheduler(s.outstandingCount())
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSessionUpdateInvalid verifies that an invalid patch is rejected and not applied
+func TestSessionUpdateInvalid(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+
+	ttl := 0
+	assert.Error(t, s.Update(SettingsPatch{TTL: &ttl}))
+
+	size := dataLength - 1
+	assert.Error(t, s.Update(SettingsPatch{PayloadSize: &size}))
+
+	interval := 100 * time.Millisecond
+	assert.Error(t, s.Update(SettingsPatch{Interval: &interval}), "non-privileged sessions have a minimal interval")
+
+	assert.Equal(t, SettingsPatch{}, s.pendingPatch)
+	assert.Empty(t, s.updateReqs)
+}
+
+// TestSessionUpdateMerge verifies that patches requested before being applied are merged
+func TestSessionUpdateMerge(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+
+	ttl, otherTTL := 5, 6
+	timeout := 3 * time.Second
+	assert.NoError(t, s.Update(SettingsPatch{TTL: &ttl, Timeout: &timeout}))
+	assert.NoError(t, s.Update(SettingsPatch{TTL: &otherTTL}))
+
+	conn := newFakeConn(true)
+	_, err = s.handleUpdateRequest(conn, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 6, s.settings.TTL)
+	assert.False(t, s.settings.IsTTLDefault)
+	assert.Equal(t, 3*time.Second, s.settings.Timeout)
+	assert.Equal(t, 6, conn.ttl)
+	assert.Equal(t, SettingsPatch{}, s.pendingPatch)
+}
+
+// TestSessionUpdateRunning verifies that an update of a running session takes effect from the next echo request on
+func TestSessionUpdateRunning(t *testing.T) {
+	s, conn := fakeSession(t, 3)
+	s.settings.Interval = time.Hour
+
+	sent := make(chan int, 3)
+	s.AddOnSend(func(s *Session, seq uint64, msg []byte) {
+		sent <- len(msg)
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Run()
+	}()
+
+	// the first echo request is sent right away, the next ones would take an hour
+	assert.Equal(t, 8+dataLength, <-sent)
+
+	interval, ttl, size := 10*time.Millisecond, 5, 100
+	assert.NoError(t, s.Update(SettingsPatch{Interval: &interval, TTL: &ttl, PayloadSize: &size}))
+
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		s.RequestStop()
+		t.Fatal("Interval update did not take effect")
+	}
+
+	assert.Equal(t, 8+size, <-sent)
+	assert.Equal(t, 8+size, <-sent)
+	assert.Equal(t, ttl, conn.ttl)
+	assert.Equal(t, uint32(3), s.Stats.GetTotalRecv())
+}
+
+// TestSessionUpdateBeforeRun verifies that an update requested before the run is applied before the connection is
+// created
+func TestSessionUpdateBeforeRun(t *testing.T) {
+	s, conn := fakeSession(t, 1)
+
+	ttl := 7
+	assert.NoError(t, s.Update(SettingsPatch{TTL: &ttl}))
+
+	listened := 0
+	s.listen = func() (packetConn, error) {
+		listened = s.settings.TTL
+		return conn, nil
+	}
+
+	assert.NoError(t, s.Run())
+	assert.Equal(t, 7, listened)
+}
+
+// TestSessionUpdateSharedSettings verifies that updating a session changes neither the settings it was created with
+// nor another session created with the same ones
+func TestSessionUpdateSharedSettings(t *testing.T) {
+	settings := DefaultSettings()
+	settings.MaxCount, settings.IsMaxCountDefault = 1, false
+	settings.Interval = 10 * time.Millisecond
+	settings.IsPrivileged = true
+	settings.Flood = true
+	original := *settings
+
+	s, err := NewSession("localhost", settings)
+	assert.NoError(t, err)
+	listenFake(s, newFakeConn(true))
+
+	other, err := NewSession("localhost", settings)
+	assert.NoError(t, err)
+
+	interval, timeout, ttl := 50*time.Millisecond, 3*time.Second, 7
+	assert.NoError(t, s.Update(SettingsPatch{Interval: &interval, Timeout: &timeout, TTL: &ttl}))
+	assert.NoError(t, s.Run())
+
+	assert.Equal(t, interval, s.Settings().Interval)
+	assert.False(t, s.Settings().Flood)
+	assert.Equal(t, original, *settings)
+	assert.Equal(t, original, other.Settings())
+}
+
+// TestSessionPauseErrors verifies that pausing twice or resuming a session that is not paused fails
+func TestSessionPauseErrors(t *testing.T) {
+	s, err := NewSession("localhost", DefaultSettings())
+	assert.NoError(t, err)
+
+	assert.Error(t, s.Resume())
+	assert.NoError(t, s.Pause())
+	assert.True(t, s.IsPaused())
+	assert.Error(t, s.Pause())
+	assert.NoError(t, s.Resume())
+	assert.False(t, s.IsPaused())
+}
+
+// TestSessionPauseResume verifies that a paused session sends nothing until resumed, keeping its statistics
+func TestSessionPauseResume(t *testing.T) {
+	s, _ := fakeSession(t, 3)
+	r := newRecorder()
+	s.AddObserver(r)
+
+	paused := make(chan struct{}, 1)
+	s.AddObserver(&pauseNotifier{paused: paused})
+
+	// paused before the run, not even the first echo request is sent
+	assert.NoError(t, s.Pause())
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Run()
+	}()
+
+	<-paused
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, uint32(0), s.Stats.GetTotalSent())
+
+	assert.NoError(t, s.Resume())
+	assert.NoError(t, <-errs)
+
+	assert.Equal(t, uint32(3), s.Stats.GetTotalRecv())
+	assert.GreaterOrEqual(t, int64(s.Stats.GetPausedDuration()), int64(50*time.Millisecond))
+	assert.Equal(t, []string{"start", "pause", "resume"}, r.calls[:3])
+}
+
+// pauseNotifier is an observer that signals when the session is paused
+type pauseNotifier struct {
+	BaseObserver
+	paused chan struct{}
+}
+
+func (n *pauseNotifier) OnPause(s *Session) {
+	n.paused <- struct{}{}
+}